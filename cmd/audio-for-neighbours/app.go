@@ -4,36 +4,83 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"reflect"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 )
 
 type app struct {
-	player   *audioPlayer
-	notifier *telegramNotifier
-	snapshot *snapshotter
-	presence *presenceTracker
+	player    *audioPlayer
+	telegram  *telegramNotifier
+	notifiers *notifierSet
+	snapshot  *snapshotter
+	presence  *presenceTracker
+	schedule  *scheduler
+	events    *eventBus
+	state     *stateStore
+	journal   *journal
+
+	changeMu sync.Mutex
 
 	mu               sync.Mutex
 	paused           bool
 	pausedBySchedule bool
+	scheduleReason   string
 	pausedByMotion   bool
 	pausedByManual   bool
 	pausedByPresence bool
 	forcePlay        bool
+	overrideUntil    time.Time
+	overrideTimer    *time.Timer
 	lastMotion       bool
+	lastMotionAt     time.Time
 	motionTimer      *time.Timer
 	currentFile      string
 	onlineTargets    []string
 	motionSnapCancel context.CancelFunc
+	lastStatus       *appStatus
+	lastStatusText   string
+	listeners        []func(appStatus)
+	accountedAt      time.Time
+	lastReasons      []string
+	playlistOverride string
+	activePlaylist   string
+}
+
+type appStatus struct {
+	Paused           bool       `json:"paused"`
+	PausedBySchedule bool       `json:"paused_by_schedule"`
+	PausedByMotion   bool       `json:"paused_by_motion"`
+	PausedByPresence bool       `json:"paused_by_presence"`
+	PausedByManual   bool       `json:"paused_by_manual"`
+	ForcePlay        bool       `json:"force_play"`
+	Reasons          []string   `json:"reasons"`
+	ScheduleReason   string     `json:"schedule_reason"`
+	NextSchedule     string     `json:"next_schedule"`
+	CurrentFile      string     `json:"current_file"`
+	OnlineTargets    []string   `json:"online_targets"`
+	Motion           bool       `json:"motion"`
+	LastMotionAt     *time.Time `json:"last_motion_at,omitempty"`
+	Override         string     `json:"override"`
+	OverrideUntil    *time.Time `json:"override_until,omitempty"`
+	Volume           int        `json:"volume"`
+	VolumeLimit      int        `json:"volume_limit"`
+	Playlist         string     `json:"playlist"`
+	PlaylistManual   bool       `json:"playlist_manual"`
+	Mode             string     `json:"mode"`
+	DSP              string     `json:"dsp"`
 }
 
-func newApp(player *audioPlayer, notifier *telegramNotifier) *app {
+func newApp(player *audioPlayer, telegram *telegramNotifier, notifiers *notifierSet) *app {
 	return &app{
-		player:   player,
-		notifier: notifier,
-		presence: newPresenceTracker(appConfig.PresenceClearDelay),
+		player:    player,
+		telegram:  telegram,
+		notifiers: notifiers,
+		presence:  newPresenceTracker(appConfig.PresenceClearDelay),
+		schedule:  newScheduler(appConfig.Schedule, appConfig.Calendars),
+		events:    newEventBus(200),
 	}
 }
 
@@ -41,6 +88,97 @@ func (a *app) setSnapshotter(snapshot *snapshotter) {
 	a.snapshot = snapshot
 }
 
+func (a *app) setJournal(j *journal) {
+	a.journal = j
+	a.events.setSink(j.append)
+}
+
+func (a *app) restoreState(store *stateStore) {
+	a.state = store
+	st := store.get()
+	if st.Volume != nil {
+		a.player.setVolume(*st.Volume)
+	}
+	if st.Mode != "" {
+		if mode, err := parsePlaybackMode(st.Mode); err == nil {
+			a.player.setMode(mode)
+		}
+	}
+	if st.DSP != nil {
+		if err := a.player.setDSP(*st.DSP); err != nil {
+			log.Printf("state: dsp: %v", err)
+		}
+	}
+	if st.Playlist != "" {
+		a.mu.Lock()
+		a.playlistOverride = st.Playlist
+		a.mu.Unlock()
+	}
+	if st.LastFile != "" {
+		a.player.resumeAt(st.LastFile, time.Duration(st.PositionMs)*time.Millisecond)
+		log.Printf("state: resuming %s at %s", st.LastFile, (time.Duration(st.PositionMs) * time.Millisecond).Round(time.Second))
+	}
+
+	mode := overrideAuto
+	switch {
+	case st.PausedByManual:
+		mode = overridePause
+	case st.ForcePlay:
+		mode = overridePlay
+	}
+	if mode == overrideAuto || (!st.OverrideUntil.IsZero() && !st.OverrideUntil.After(time.Now())) {
+		a.saveState()
+		return
+	}
+	log.Printf("state: restoring manual override")
+	a.setOverride(mode, st.OverrideUntil, "restored")
+}
+
+func (a *app) saveState() {
+	if a.state == nil {
+		return
+	}
+	file, pos := a.player.progress()
+	volume := a.player.getVolume()
+	mode := a.player.getMode()
+	dsp := a.player.getDSP()
+	a.mu.Lock()
+	manual, force, until := a.pausedByManual, a.forcePlay, a.overrideUntil
+	playlist := a.playlistOverride
+	a.mu.Unlock()
+
+	a.state.update(func(st *persistedState) {
+		st.PausedByManual = manual
+		st.ForcePlay = force
+		st.OverrideUntil = until
+		st.Volume = &volume
+		st.Playlist = playlist
+		st.Mode = string(mode)
+		st.DSP = &dsp
+		if file != "" {
+			st.LastFile = file
+			st.PositionMs = pos.Milliseconds()
+		}
+	})
+}
+
+// statePositionInterval is how often the playback position alone is saved.
+// Everything else is saved when it changes.
+const statePositionInterval = 2 * time.Minute
+
+func (a *app) runStatePersistence(ctx context.Context) {
+	ticker := time.NewTicker(statePositionInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			a.saveState()
+		}
+	}
+}
+
 func (a *app) runFileNotifications(ctx context.Context) {
 	for {
 		select {
@@ -50,26 +188,66 @@ func (a *app) runFileNotifications(ctx context.Context) {
 			a.mu.Lock()
 			a.currentFile = file
 			a.mu.Unlock()
-			a.notify(fmt.Sprintf("Now playing: %s", file))
+			a.events.publish(appEvent{Type: eventFile, Action: "start", Name: file})
+			a.notify(eventFile, fmt.Sprintf("Now playing: %s", file))
+			a.stateChanged()
+			a.saveState()
 		}
 	}
 }
 
+func (a *app) runLibraryWatch(ctx context.Context) {
+	watchLibrary(ctx, appConfig.AudioDir, func(added, removed []string) {
+		a.player.libraryChanged()
+		for _, name := range added {
+			a.events.publish(appEvent{Type: eventFile, Action: "added", Name: name})
+		}
+		for _, name := range removed {
+			a.events.publish(appEvent{Type: eventFile, Action: "removed", Name: name})
+		}
+		var lines []string
+		if len(added) > 0 {
+			lines = append(lines, "Added to library: "+strings.Join(added, ", "))
+		}
+		if len(removed) > 0 {
+			lines = append(lines, "Removed from library: "+strings.Join(removed, ", "))
+		}
+		a.notify(eventFile, strings.Join(lines, "\n"))
+	})
+}
+
 func (a *app) runScheduleLoop(ctx context.Context) {
 	ticker := time.NewTicker(30 * time.Second)
 	defer ticker.Stop()
 
-	a.setSchedulePause(isQuietHours(time.Now()), "schedule check")
+	a.setSchedulePause(a.schedule.state(time.Now()))
+	a.applyVolumeLimit(time.Now())
+	a.applyPlaylist(time.Now())
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			a.setSchedulePause(isQuietHours(time.Now()), "schedule check")
+			a.schedule.reload()
+			a.setSchedulePause(a.schedule.state(time.Now()))
+			a.applyVolumeLimit(time.Now())
+			a.applyPlaylist(time.Now())
 		}
 	}
 }
 
+func (a *app) nextScheduleText(now time.Time) string {
+	at, quiet, ok := a.schedule.nextTransition(now)
+	if !ok {
+		return "none"
+	}
+	state := "play"
+	if quiet {
+		state = "quiet"
+	}
+	return fmt.Sprintf("%s at %s", state, formatTransition(at, now))
+}
+
 func (a *app) runPresenceEvents(ctx context.Context) {
 	for {
 		select {
@@ -91,10 +269,15 @@ func (a *app) handlePresenceUpdate(online []string) {
 }
 
 func (a *app) handlePresenceEvent(evt presenceEvent) {
+	action := "offline"
+	if evt.Online {
+		action = "online"
+	}
+	a.events.publish(appEvent{Type: eventPresence, Action: action, Name: evt.Name})
 	if evt.Online {
-		a.notify(fmt.Sprintf("Presence online: %s", evt.Name))
+		a.notify(eventPresence, fmt.Sprintf("Presence online: %s", evt.Name))
 	} else {
-		a.notify(fmt.Sprintf("Presence offline: %s", evt.Name))
+		a.notify(eventPresence, fmt.Sprintf("Presence offline: %s", evt.Name))
 	}
 	a.applyPresenceState()
 }
@@ -118,7 +301,16 @@ func (a *app) applyPresenceState() {
 func (a *app) handleMotionUpdate(detected bool, names []string) {
 	a.mu.Lock()
 	a.lastMotion = detected
+	if detected {
+		a.lastMotionAt = time.Now()
+	}
 	a.mu.Unlock()
+	action := "stop"
+	if detected {
+		action = "start"
+	}
+	a.events.publish(appEvent{Type: eventMotion, Action: action, Name: strings.Join(names, ", ")})
+	a.stateChanged()
 
 	if detected {
 		a.setMotionPause(true, fmt.Sprintf("motion detected (%s)", strings.Join(names, ", ")))
@@ -143,11 +335,12 @@ func (a *app) startMotionResumeTimer() {
 	a.mu.Unlock()
 }
 
-func (a *app) setSchedulePause(paused bool, trigger string) {
+func (a *app) setSchedulePause(paused bool, reason string) {
 	a.mu.Lock()
 	a.pausedBySchedule = paused
+	a.scheduleReason = reason
 	a.mu.Unlock()
-	a.applyState(trigger)
+	a.applyState(reason)
 }
 
 func (a *app) setMotionPause(paused bool, trigger string) {
@@ -170,22 +363,112 @@ func (a *app) setPresencePause(paused bool, trigger string) {
 	a.applyState(trigger)
 }
 
-func (a *app) setManualPause(paused bool, trigger string) {
+type overrideMode int
+
+const (
+	overrideAuto overrideMode = iota
+	overridePause
+	overridePlay
+)
+
+func (a *app) setOverride(mode overrideMode, until time.Time, trigger string) {
 	a.mu.Lock()
-	a.pausedByManual = paused
+	if a.overrideTimer != nil {
+		a.overrideTimer.Stop()
+		a.overrideTimer = nil
+	}
+	a.overrideUntil = until
+	a.pausedByManual = mode == overridePause
+	a.forcePlay = mode == overridePlay
+	if mode != overrideAuto && !until.IsZero() {
+		var timer *time.Timer
+		timer = time.AfterFunc(time.Until(until), func() {
+			a.expireOverride(timer)
+		})
+		a.overrideTimer = timer
+	}
 	a.mu.Unlock()
 	a.applyState(trigger)
+	a.saveState()
 }
 
-func (a *app) setForcePlay(enabled bool, trigger string) {
+func (a *app) expireOverride(timer *time.Timer) {
 	a.mu.Lock()
-	a.forcePlay = enabled
+	if a.overrideTimer != timer {
+		a.mu.Unlock()
+		return
+	}
 	a.mu.Unlock()
-	a.applyState(trigger)
+	log.Printf("manual override expired")
+	a.setOverride(overrideAuto, time.Time{}, "override expired")
+}
+
+func (a *app) overrideTextLocked(now time.Time) string {
+	var mode string
+	switch {
+	case a.pausedByManual:
+		mode = "pause"
+	case a.forcePlay:
+		mode = "play"
+	default:
+		return "none"
+	}
+	if a.overrideUntil.IsZero() {
+		return mode + " (until /auto)"
+	}
+	remaining := a.overrideUntil.Sub(now).Round(time.Minute)
+	if remaining < time.Minute {
+		remaining = a.overrideUntil.Sub(now).Round(time.Second)
+	}
+	return fmt.Sprintf("%s for %s (until %s)", mode, remaining, formatTransition(a.overrideUntil, now))
+}
+
+func (a *app) runPlaybackMetrics(ctx context.Context) {
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			a.mu.Lock()
+			a.accountPlaybackLocked(now)
+			a.mu.Unlock()
+			metricVolume.Set(float64(a.player.getVolume()))
+		}
+	}
+}
+
+func (a *app) accountPlaybackLocked(now time.Time) {
+	if !a.accountedAt.IsZero() {
+		seconds := now.Sub(a.accountedAt).Seconds()
+		if !a.paused {
+			metricPlayingSeconds.Add(seconds)
+		} else {
+			active := map[string]bool{
+				"schedule": a.pausedBySchedule,
+				"motion":   a.pausedByMotion,
+				"presence": a.pausedByPresence,
+				"manual":   a.pausedByManual,
+			}
+			for _, reason := range pauseMetricReasons {
+				if active[reason] {
+					metricPausedSeconds.WithLabelValues(reason).Add(seconds)
+				}
+			}
+		}
+	}
+	a.accountedAt = now
+	if a.paused {
+		metricPaused.Set(1)
+	} else {
+		metricPaused.Set(0)
+	}
 }
 
 func (a *app) applyState(trigger string) {
 	a.mu.Lock()
+	a.accountPlaybackLocked(time.Now())
 	shouldPause := a.pausedBySchedule || a.pausedByMotion || a.pausedByPresence
 	if a.forcePlay {
 		shouldPause = false
@@ -195,27 +478,214 @@ func (a *app) applyState(trigger string) {
 	}
 	wasPaused := a.paused
 	if shouldPause == wasPaused {
+		reasons := a.pauseReasonsLocked()
+		changed := shouldPause && !stringSlicesEqual(reasons, a.lastReasons)
+		a.lastReasons = reasons
+		currentFile := a.currentFile
 		a.mu.Unlock()
+		if changed {
+			a.events.publish(appEvent{Type: eventState, Action: "update", Name: currentFile, Trigger: trigger, Reasons: reasons})
+		}
+		a.stateChanged()
 		return
 	}
 	a.paused = shouldPause
 	reasons := a.pauseReasonsLocked()
+	a.lastReasons = reasons
 	currentFile := a.currentFile
+	instant := shouldPause && a.pausedByManual && appConfig.InstantManualPause
 	a.mu.Unlock()
 
-	a.player.setPaused(shouldPause)
+	a.player.setPaused(shouldPause, instant)
 
+	action := "resume"
 	if shouldPause {
-		a.notify(fmt.Sprintf("Playback paused (%s). Reasons: %s. Current: %s", trigger, strings.Join(reasons, ", "), currentFile))
+		action = "pause"
+	}
+	a.events.publish(appEvent{Type: eventState, Action: action, Name: currentFile, Trigger: trigger, Reasons: reasons})
+
+	if shouldPause {
+		a.notify(eventState, fmt.Sprintf("Playback paused (%s). Reasons: %s. Current: %s", trigger, strings.Join(reasons, ", "), currentFile))
+	} else {
+		a.notify(eventState, fmt.Sprintf("Playback resumed (%s). Current: %s", trigger, currentFile))
+	}
+	a.stateChanged()
+	a.saveState()
+}
+
+func (a *app) applyVolumeLimit(now time.Time) {
+	limit := a.schedule.volumeLimit(now)
+	if limit == a.player.getVolumeLimit() {
 		return
 	}
-	a.notify(fmt.Sprintf("Playback resumed (%s). Current: %s", trigger, currentFile))
+	log.Printf("schedule volume limit: %d%%", limit)
+	a.player.setVolumeLimit(limit)
+	a.stateChanged()
+}
+
+func (a *app) applyPlaylist(now time.Time) {
+	a.mu.Lock()
+	name := a.playlistOverride
+	if name == "" {
+		name = a.schedule.playlist(now)
+	}
+	if name == playlistAll {
+		name = ""
+	}
+	changed := name != a.activePlaylist
+	a.activePlaylist = name
+	a.mu.Unlock()
+	if !changed {
+		return
+	}
+	if name == "" {
+		log.Printf("playlist: all files")
+	} else {
+		log.Printf("playlist: %s", name)
+	}
+	a.player.setPlaylist(name)
+	a.stateChanged()
+}
+
+func (a *app) setPlaylistOverride(name string) {
+	a.mu.Lock()
+	a.playlistOverride = name
+	a.mu.Unlock()
+	a.applyPlaylist(time.Now())
+	a.saveState()
+}
+
+func (a *app) setMode(mode playbackMode) {
+	if a.player.getMode() == mode {
+		return
+	}
+	a.player.setMode(mode)
+	log.Printf("playback mode: %s", mode)
+	a.saveState()
+	a.stateChanged()
+}
+
+func (a *app) setDSP(name string) error {
+	if err := a.player.setDSP(name); err != nil {
+		return err
+	}
+	log.Printf("dsp: %s", formatDSP(name))
+	a.saveState()
+	a.stateChanged()
+	return nil
+}
+
+func (a *app) libraryCommand(req commandRequest) string {
+	const usage = "Usage: /library, /library rename <n> <new name>, /library delete <n>"
+	action, rest, _ := strings.Cut(req.args, " ")
+	rest = strings.TrimSpace(rest)
+	dir := appConfig.AudioDir
+	switch strings.ToLower(action) {
+	case "", "list":
+		files, err := libraryFiles(dir)
+		if err != nil {
+			return fmt.Sprintf("Library error: %v", err)
+		}
+		return formatLibrary(files)
+	case "rename", "mv":
+		if req.role < roleOperator {
+			return "Renaming requires the operator role."
+		}
+		ref, newName, _ := strings.Cut(rest, " ")
+		if strings.TrimSpace(newName) == "" {
+			return usage
+		}
+		name, err := resolveLibraryFile(dir, ref)
+		if err != nil {
+			return fmt.Sprintf("Library error: %v", err)
+		}
+		target, err := renameLibraryFile(dir, name, newName)
+		if err != nil {
+			return fmt.Sprintf("Rename failed: %v", err)
+		}
+		log.Printf("library: %s renamed to %s via %s", name, target, req.source)
+		return fmt.Sprintf("Renamed %s to %s.", name, target)
+	case "delete", "rm", "remove":
+		if req.role < roleOperator {
+			return "Deleting requires the operator role."
+		}
+		if rest == "" {
+			return usage
+		}
+		name, err := resolveLibraryFile(dir, rest)
+		if err != nil {
+			return fmt.Sprintf("Library error: %v", err)
+		}
+		if err := deleteLibraryFile(dir, name); err != nil {
+			return fmt.Sprintf("Delete failed: %v", err)
+		}
+		log.Printf("library: %s deleted via %s", name, req.source)
+		return fmt.Sprintf("Deleted %s.", name)
+	default:
+		return usage
+	}
+}
+
+func (a *app) playlistText() string {
+	a.mu.Lock()
+	name, manual := a.activePlaylist, a.playlistOverride != ""
+	a.mu.Unlock()
+	if name == "" {
+		name = "all files"
+	}
+	if manual {
+		return name + " (manual, /playlist auto to follow the schedule)"
+	}
+	return name + " (schedule)"
+}
+
+func (a *app) setVolume(percent int) {
+	a.player.setVolume(percent)
+	metricVolume.Set(float64(a.player.getVolume()))
+	a.saveState()
+	a.stateChanged()
+}
+
+func (a *app) onStateChange(fn func(appStatus)) {
+	a.mu.Lock()
+	a.listeners = append(a.listeners, fn)
+	a.mu.Unlock()
+}
+
+// stateChanged must not wait on the network: it is called from the player,
+// the HTTP and MQTT handlers and the pollers.
+func (a *app) stateChanged() {
+	// Serialized so that two concurrent changes reach the listeners in the
+	// order their statuses were taken.
+	a.changeMu.Lock()
+	defer a.changeMu.Unlock()
+	status := a.status()
+	text := formatStatus(status)
+	a.mu.Lock()
+	// The status text leaves out fields like motion that MQTT and the
+	// event stream still need to see change.
+	if a.lastStatus != nil && reflect.DeepEqual(*a.lastStatus, status) {
+		a.mu.Unlock()
+		return
+	}
+	a.lastStatus = &status
+	textChanged := text != a.lastStatusText
+	a.lastStatusText = text
+	listeners := append([]func(appStatus){}, a.listeners...)
+	a.mu.Unlock()
+
+	if a.telegram != nil && textChanged {
+		a.telegram.updatePanels()
+	}
+	for _, fn := range listeners {
+		fn(status)
+	}
 }
 
 func (a *app) pauseReasonsLocked() []string {
 	var reasons []string
 	if a.pausedBySchedule {
-		reasons = append(reasons, "quiet hours")
+		reasons = append(reasons, a.scheduleReason)
 	}
 	if a.pausedByMotion {
 		reasons = append(reasons, "motion")
@@ -239,31 +709,163 @@ func (a *app) pauseReasonsLocked() []string {
 	return reasons
 }
 
-func (a *app) handleCommand(cmd string) string {
-	switch cmd {
+func (a *app) handleCommand(req commandRequest) string {
+	args := req.args
+	switch req.name {
 	case "pause", "stop", "disable":
-		a.setForcePlay(false, "telegram")
-		a.setManualPause(true, "telegram")
-		return "Playback paused by manual command."
+		until, err := parseOverrideUntil(args, time.Now(), a.schedule.location())
+		if err != nil {
+			return fmt.Sprintf("Usage: /pause [2h | until 18:00]: %v", err)
+		}
+		a.setOverride(overridePause, until, req.source)
+		if until.IsZero() {
+			return "Playback paused by manual command."
+		}
+		return fmt.Sprintf("Playback paused until %s, then automatic control.", formatTransition(until, time.Now()))
 	case "play", "start", "enable":
-		a.setManualPause(false, "telegram")
-		a.setForcePlay(true, "telegram")
-		return "Playback forced on by manual command."
+		until, err := parseOverrideUntil(args, time.Now(), a.schedule.location())
+		if err != nil {
+			return fmt.Sprintf("Usage: /play [2h | until 18:00]: %v", err)
+		}
+		a.setOverride(overridePlay, until, req.source)
+		if until.IsZero() {
+			return "Playback forced on by manual command."
+		}
+		return fmt.Sprintf("Playback forced on until %s, then automatic control.", formatTransition(until, time.Now()))
 	case "auto":
-		a.setForcePlay(false, "telegram")
-		a.setManualPause(false, "telegram")
+		a.setOverride(overrideAuto, time.Time{}, req.source)
 		return "Playback returned to automatic control."
+	case "skip", "next":
+		a.player.skip()
+		return "Skipping to the next file."
 	case "status":
-		a.mu.Lock()
-		paused := a.paused
-		reasons := a.pauseReasonsLocked()
-		current := a.currentFile
-		forced := a.forcePlay
-		online := strings.Join(a.onlineTargets, ", ")
-		a.mu.Unlock()
-		return fmt.Sprintf("Paused=%v, forced=%v, reasons=%s, current=%s, online=%s", paused, forced, strings.Join(reasons, ", "), current, online)
+		return a.statusText()
+	case "schedule":
+		now := time.Now()
+		return a.schedule.describe(now) + "\nNext: " + a.nextScheduleText(now)
+	case "volume", "vol":
+		if args == "" {
+			return formatVolume(a.status())
+		}
+		level, err := strconv.Atoi(strings.TrimPrefix(args, "+"))
+		if err != nil {
+			return "Usage: /volume <0-100 | +10 | -10>"
+		}
+		if strings.HasPrefix(args, "+") || strings.HasPrefix(args, "-") {
+			level = max(0, min(100, a.player.getVolume()+level))
+		}
+		if level < 0 || level > 100 {
+			return "Usage: /volume <0-100 | +10 | -10>"
+		}
+		a.setVolume(level)
+		return formatVolume(a.status())
+	case "playlist", "playlists":
+		switch name := strings.TrimSpace(args); name {
+		case "":
+			names, err := listPlaylists(appConfig.PlaylistDir)
+			if err != nil {
+				return fmt.Sprintf("Playlist error: %v", err)
+			}
+			available := "none"
+			if len(names) > 0 {
+				available = strings.Join(names, ", ")
+			}
+			return "Playlist: " + a.playlistText() + "\nAvailable: " + available + "\nUsage: /playlist <name | all | auto>"
+		case "auto":
+			a.setPlaylistOverride("")
+		case playlistAll:
+			a.setPlaylistOverride(playlistAll)
+		default:
+			if _, err := loadPlaylist(appConfig.PlaylistDir, name); err != nil {
+				return fmt.Sprintf("Playlist error: %v", err)
+			}
+			a.setPlaylistOverride(name)
+		}
+		return "Playlist: " + a.playlistText() + ". It starts after the file already queued."
+	case "mode":
+		if strings.TrimSpace(args) == "" {
+			return fmt.Sprintf("Mode: %s\nUsage: /mode <sequential | shuffle | weighted>", a.player.getMode())
+		}
+		mode, err := parsePlaybackMode(args)
+		if err != nil {
+			return "Usage: /mode <sequential | shuffle | weighted>"
+		}
+		a.setMode(mode)
+		return fmt.Sprintf("Mode: %s. It applies from the file after the one already queued.", mode)
+	case "dsp", "eq":
+		name := strings.TrimSpace(args)
+		if name == "" {
+			available := append([]string{dspOff}, a.player.dspPresetNames()...)
+			return fmt.Sprintf("DSP: %s\nAvailable: %s\nUsage: /dsp <preset | off>", formatDSP(a.player.getDSP()), strings.Join(available, ", "))
+		}
+		if strings.EqualFold(name, dspOff) {
+			name = ""
+		}
+		if err := a.setDSP(name); err != nil {
+			return fmt.Sprintf("DSP error: %v", err)
+		}
+		return "DSP: " + formatDSP(name)
+	case "upload":
+		if len(req.data) == 0 {
+			return "Send an audio file or a voice message to add it to the library; a caption sets its name."
+		}
+		name, length, err := addToLibrary(appConfig.AudioDir, args, req.data, appConfig.Telegram.FFmpeg)
+		if err != nil {
+			log.Printf("upload error: %v", err)
+			return fmt.Sprintf("Upload rejected: %v", err)
+		}
+		log.Printf("library: %s uploaded via %s", name, req.source)
+		return fmt.Sprintf("Saved %s (%s). It joins the loop in a few seconds.", name, length.Round(time.Second))
+	case "library", "files":
+		return a.libraryCommand(req)
+	case "history":
+		if a.journal == nil {
+			return "Journal not available."
+		}
+		n := 10
+		if args != "" {
+			v, err := strconv.Atoi(args)
+			if err != nil || v <= 0 {
+				return "Usage: /history [n]"
+			}
+			n = min(v, 50)
+		}
+		text, err := a.journal.history(n, a.schedule.location())
+		if err != nil {
+			return fmt.Sprintf("History error: %v", err)
+		}
+		return text
+	case "stats":
+		if a.journal == nil {
+			return "Journal not available."
+		}
+		now := time.Now()
+		day, err := parseStatsDay(args, now, a.schedule.location())
+		if err != nil {
+			return fmt.Sprintf("Usage: /stats [today | yesterday | YYYY-MM-DD]: %v", err)
+		}
+		stats, err := a.journal.stats(day, now)
+		if err != nil {
+			return fmt.Sprintf("Stats error: %v", err)
+		}
+		return stats.String()
+	case "reload":
+		cfg, err := loadConfig(configPath)
+		if err != nil {
+			return fmt.Sprintf("Reload failed: %v", err)
+		}
+		a.schedule.replace(cfg.Schedule, cfg.Calendars)
+		a.player.setDSPPresets(cfg.DSP.Presets)
+		if err := a.player.setDSP(a.player.getDSP()); err != nil {
+			log.Printf("dsp: %v, switching off", err)
+			a.setDSP("")
+		}
+		a.setSchedulePause(a.schedule.state(time.Now()))
+		a.applyVolumeLimit(time.Now())
+		a.applyPlaylist(time.Now())
+		return "Schedule, calendars and DSP presets reloaded."
 	case "snapshot":
-		if a.snapshot == nil || a.notifier == nil {
+		if a.snapshot == nil || a.telegram == nil {
 			return "Snapshot not available."
 		}
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -272,13 +874,110 @@ func (a *app) handleCommand(cmd string) string {
 		if err != nil {
 			return fmt.Sprintf("Snapshot error: %v", err)
 		}
-		a.notifier.sendPhotoBytes("snapshot.jpg", image)
+		a.telegram.sendPhotoBytes(req.chatID, "snapshot.jpg", image)
 		return "Snapshot sent."
 	default:
-		return "Commands: /play (force on), /pause, /auto, /status, /snapshot, /enable, /disable"
+		if a.telegram == nil {
+			return "Commands: /play [2h | until 18:00] (force on), /pause [2h | until 18:00], /auto, /skip, /volume [0-100], /playlist [name | all | auto], /mode [sequential | shuffle | weighted], /dsp [preset | off], /library, /status, /snapshot, /schedule, /history [n], /stats [day], /reload"
+		}
+		a.telegram.showPanel(req.chatID)
+		return ""
 	}
 }
 
+func (a *app) status() appStatus {
+	now := time.Now()
+	a.mu.Lock()
+	status := appStatus{
+		Paused:           a.paused,
+		PausedBySchedule: a.pausedBySchedule,
+		PausedByMotion:   a.pausedByMotion,
+		PausedByPresence: a.pausedByPresence,
+		PausedByManual:   a.pausedByManual,
+		ForcePlay:        a.forcePlay,
+		Reasons:          a.pauseReasonsLocked(),
+		ScheduleReason:   a.scheduleReason,
+		CurrentFile:      a.currentFile,
+		OnlineTargets:    append([]string{}, a.onlineTargets...),
+		Motion:           a.lastMotion,
+		Override:         a.overrideTextLocked(now),
+	}
+	if !a.overrideUntil.IsZero() {
+		until := a.overrideUntil
+		status.OverrideUntil = &until
+	}
+	if !a.lastMotionAt.IsZero() {
+		at := a.lastMotionAt
+		status.LastMotionAt = &at
+	}
+	status.Playlist = a.activePlaylist
+	status.PlaylistManual = a.playlistOverride != ""
+	a.mu.Unlock()
+	status.Mode = string(a.player.getMode())
+	status.DSP = a.player.getDSP()
+	status.NextSchedule = a.nextScheduleText(now)
+	status.Volume = a.player.getVolume()
+	status.VolumeLimit = a.player.getVolumeLimit()
+	return status
+}
+
+func (a *app) statusText() string {
+	return formatStatus(a.status())
+}
+
+func formatStatus(status appStatus) string {
+	state := "playing"
+	if status.Paused {
+		state = "paused"
+	}
+	current := status.CurrentFile
+	if current == "" {
+		current = "-"
+	}
+	online := strings.Join(status.OnlineTargets, ", ")
+	if online == "" {
+		online = "-"
+	}
+	lines := []string{
+		"State: " + state,
+		"Reasons: " + strings.Join(status.Reasons, ", "),
+		"Current: " + current,
+		"Online: " + online,
+		"Override: " + status.Override,
+		formatVolume(status),
+		"Playlist: " + formatPlaylist(status),
+		"Mode: " + status.Mode,
+		"DSP: " + formatDSP(status.DSP),
+		"Next schedule: " + status.NextSchedule,
+	}
+	return strings.Join(lines, "\n")
+}
+
+func formatDSP(preset string) string {
+	if preset == "" {
+		return dspOff
+	}
+	return preset
+}
+
+func formatPlaylist(status appStatus) string {
+	name := status.Playlist
+	if name == "" {
+		name = "all files"
+	}
+	if status.PlaylistManual {
+		return name + " (manual)"
+	}
+	return name
+}
+
+func formatVolume(status appStatus) string {
+	if status.VolumeLimit < status.Volume {
+		return fmt.Sprintf("Volume: %d%% (schedule limit %d%%)", status.Volume, status.VolumeLimit)
+	}
+	return fmt.Sprintf("Volume: %d%%", status.Volume)
+}
+
 func stringSlicesEqual(a, b []string) bool {
 	if len(a) != len(b) {
 		return false
@@ -291,16 +990,13 @@ func stringSlicesEqual(a, b []string) bool {
 	return true
 }
 
-func (a *app) notify(msg string) {
+func (a *app) notify(kind, msg string) {
 	log.Printf("%s", msg)
-	if a.notifier == nil {
-		return
-	}
-	a.notifier.send(msg)
+	a.notifiers.notify(kind, msg)
 }
 
 func (a *app) startMotionSnapshots() {
-	if a.snapshot == nil || a.notifier == nil {
+	if a.snapshot == nil || !a.notifiers.wants(eventMotion) {
 		return
 	}
 
@@ -340,7 +1036,7 @@ func (a *app) motionSnapshotLoop(ctx context.Context) {
 				log.Printf("snapshot error: %v", err)
 				continue
 			}
-			a.notifier.sendPhotoBytes("motion.jpg", image)
+			a.notifiers.photo(eventMotion, "motion.jpg", image)
 		}
 	}
 }
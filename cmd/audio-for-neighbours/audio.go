@@ -2,59 +2,238 @@ package main
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"io"
 	"log"
+	"math"
 	"os"
 	"path/filepath"
-	"sort"
-	"strings"
 	"sync"
 	"time"
 
 	"github.com/faiface/beep"
-	"github.com/faiface/beep/mp3"
-	"github.com/faiface/beep/speaker"
-	"github.com/faiface/beep/wav"
+	"github.com/faiface/beep/effects"
 )
 
 type audioPlayer struct {
 	dir            string
+	output         Output
+	playlistDir    string
+	playlist       string
+	playlistErr    string
+	mode           playbackMode
 	baseSampleRate beep.SampleRate
+	queue          *trackQueue
 	ctrlMu         sync.Mutex
-	ctrl           *beep.Ctrl
+	fader          *fader
+	fadeIn         time.Duration
+	fadeOut        time.Duration
+	crossfade      time.Duration
+	loudness       *loudnessAnalyzer
+	dspPresets     map[string]DSPPresetConfig
+	dspPreset      string
+	dsp            *dspChain
+	gain           *effects.Volume
+	volume         int
+	volumeLimit    int
 	pausedMu       sync.Mutex
 	paused         bool
 	fileStartedCh  chan string
+	changedCh      chan struct{}
+	resumeFile     string
+	resumePos      time.Duration
 }
 
-func newAudioPlayer(dir string) *audioPlayer {
-	return &audioPlayer{
+func newAudioPlayer(dir, playlistDir string, output Output) *audioPlayer {
+	p := &audioPlayer{
 		dir:           dir,
+		output:        output,
+		playlistDir:   playlistDir,
+		volume:        100,
+		volumeLimit:   100,
+		mode:          modeSequential,
 		fileStartedCh: make(chan string, 1),
+		changedCh:     make(chan struct{}, 1),
 	}
+	p.queue = newTrackQueue(func(t *track) {
+		if m, ok := output.(outputMarker); ok {
+			m.Mark(t.name())
+		}
+		select {
+		case p.fileStartedCh <- t.name():
+		default:
+		}
+	})
+	return p
 }
 
 func (p *audioPlayer) fileStarted() <-chan string {
 	return p.fileStartedCh
 }
 
-func (p *audioPlayer) setPaused(paused bool) {
+func (p *audioPlayer) setFade(in, out, crossfade time.Duration) {
+	p.ctrlMu.Lock()
+	p.fadeIn = in
+	p.fadeOut = out
+	p.crossfade = crossfade
+	p.ctrlMu.Unlock()
+}
+
+func (p *audioPlayer) setLoudness(l *loudnessAnalyzer) {
+	p.ctrlMu.Lock()
+	p.loudness = l
+	p.ctrlMu.Unlock()
+}
+
+func (p *audioPlayer) setDSPPresets(presets map[string]DSPPresetConfig) {
+	p.ctrlMu.Lock()
+	p.dspPresets = presets
+	p.ctrlMu.Unlock()
+}
+
+// setDSP switches the filter chain to a preset, "" bypasses it.
+func (p *audioPlayer) setDSP(name string) error {
+	p.ctrlMu.Lock()
+	preset, ok := p.dspPresets[name]
+	if name != "" && !ok {
+		p.ctrlMu.Unlock()
+		return fmt.Errorf("unknown preset %q", name)
+	}
+	p.dspPreset = name
+	dsp, rate := p.dsp, p.baseSampleRate
+	p.ctrlMu.Unlock()
+
+	if dsp == nil {
+		return nil
+	}
+	stages, err := buildDSPStages(preset, float64(rate))
+	if err != nil {
+		return err
+	}
+	p.output.Lock()
+	dsp.stages = stages
+	p.output.Unlock()
+	return nil
+}
+
+func (p *audioPlayer) getDSP() string {
+	p.ctrlMu.Lock()
+	defer p.ctrlMu.Unlock()
+	return p.dspPreset
+}
+
+func (p *audioPlayer) dspPresetNames() []string {
+	p.ctrlMu.Lock()
+	defer p.ctrlMu.Unlock()
+	return dspPresetNames(p.dspPresets)
+}
+
+func (p *audioPlayer) setPaused(paused, instant bool) {
 	p.pausedMu.Lock()
 	p.paused = paused
 	p.pausedMu.Unlock()
 
 	p.ctrlMu.Lock()
-	ctrl := p.ctrl
+	f := p.fader
 	p.ctrlMu.Unlock()
 
-	if ctrl == nil {
+	if f == nil {
 		return
 	}
-	speaker.Lock()
-	ctrl.Paused = paused
-	speaker.Unlock()
+	p.output.Lock()
+	f.setPaused(paused, instant)
+	p.output.Unlock()
+}
+
+func (p *audioPlayer) setVolume(percent int) {
+	if percent < 0 {
+		percent = 0
+	}
+	if percent > 100 {
+		percent = 100
+	}
+	p.ctrlMu.Lock()
+	p.volume = percent
+	p.ctrlMu.Unlock()
+	p.updateGain()
+}
+
+func (p *audioPlayer) setVolumeLimit(percent int) {
+	p.ctrlMu.Lock()
+	changed := p.volumeLimit != percent
+	p.volumeLimit = percent
+	p.ctrlMu.Unlock()
+	if changed {
+		p.updateGain()
+	}
+}
+
+func (p *audioPlayer) updateGain() {
+	p.ctrlMu.Lock()
+	gain := p.gain
+	level := p.effectiveVolumeLocked()
+	p.ctrlMu.Unlock()
+
+	if gain == nil {
+		return
+	}
+	p.output.Lock()
+	applyVolume(gain, level)
+	p.output.Unlock()
+}
+
+func (p *audioPlayer) getVolume() int {
+	p.ctrlMu.Lock()
+	defer p.ctrlMu.Unlock()
+	return p.volume
+}
+
+func (p *audioPlayer) getVolumeLimit() int {
+	p.ctrlMu.Lock()
+	defer p.ctrlMu.Unlock()
+	return p.volumeLimit
+}
+
+func (p *audioPlayer) effectiveVolumeLocked() int {
+	return min(p.volume, p.volumeLimit)
+}
+
+func volumeToDB(percent int) float64 {
+	if percent <= 0 {
+		return math.Inf(-1)
+	}
+	return 40 * math.Log10(float64(percent)/100)
+}
+
+func applyVolume(gain *effects.Volume, percent int) {
+	gain.Base = 10
+	gain.Silent = percent <= 0
+	if !gain.Silent {
+		gain.Volume = volumeToDB(percent) / 20
+	}
+}
+
+func (p *audioPlayer) resumeAt(file string, pos time.Duration) {
+	p.ctrlMu.Lock()
+	p.resumeFile = file
+	p.resumePos = pos
+	p.ctrlMu.Unlock()
+}
+
+func (p *audioPlayer) takeResume() (string, time.Duration) {
+	p.ctrlMu.Lock()
+	defer p.ctrlMu.Unlock()
+	file, pos := p.resumeFile, p.resumePos
+	p.resumeFile, p.resumePos = "", 0
+	return file, pos
+}
+
+func (p *audioPlayer) progress() (string, time.Duration) {
+	return p.queue.progress()
+}
+
+func (p *audioPlayer) skip() {
+	p.queue.skip()
 }
 
 func (p *audioPlayer) isPaused() bool {
@@ -64,7 +243,8 @@ func (p *audioPlayer) isPaused() bool {
 }
 
 func (p *audioPlayer) run(ctx context.Context) {
-	var lastPlayed string
+	var seq sequencer
+	failures := 0
 	for {
 		select {
 		case <-ctx.Done():
@@ -72,117 +252,210 @@ func (p *audioPlayer) run(ctx context.Context) {
 		default:
 		}
 
-		files, err := listAudioFiles(p.dir)
+		gen, rewind := p.queue.takeRewind()
+		if rewind != nil {
+			seq = *rewind
+		}
+		source, entries, err := p.entries()
 		if err != nil {
 			log.Printf("audio list error: %v", err)
-			time.Sleep(30 * time.Second)
+			p.waitForChange(ctx, 30*time.Second)
 			continue
 		}
-		if len(files) == 0 {
+		if len(entries) == 0 {
 			log.Printf("audio: no files in %s", p.dir)
-			time.Sleep(30 * time.Second)
+			p.waitForChange(ctx, 30*time.Second)
 			continue
 		}
 
-		nextIndex := nextFileIndex(files, lastPlayed)
-		file := files[nextIndex]
-		if err := p.playFile(ctx, file); err != nil && !errors.Is(err, context.Canceled) {
+		mode := p.getMode()
+		if mode == modeWeighted {
+			resolveWeights(entries)
+		}
+		var entry playlistEntry
+		var start time.Duration
+		resumed := false
+		if resumeFile, resumePos := p.takeResume(); resumeFile != "" {
+			if entry, resumed = seq.resume(source, entries, resumeFile); resumed {
+				start = resumePos
+			}
+		}
+		if !resumed {
+			entry = seq.next(source, mode, entries)
+		}
+
+		t, err := p.openTrack(entry.path, start, entry.gainDB)
+		if err != nil {
 			log.Printf("audio play error: %v", err)
+			if failures++; failures >= len(entries) {
+				failures = 0
+				p.waitForChange(ctx, 30*time.Second)
+			}
+			continue
 		}
-		lastPlayed = file
-		if ctx.Err() != nil {
+		failures = 0
+		t.gen = gen
+		t.seq = seq.clone()
+		// Blocks until the queue has room, so the next file is always
+		// decoded and ready before the current one ends.
+		if !p.queue.push(ctx, t) {
 			return
 		}
 	}
 }
 
-func (p *audioPlayer) playFile(ctx context.Context, path string) error {
-	f, err := os.Open(path)
-	if err != nil {
-		return err
+func (p *audioPlayer) setMode(mode playbackMode) {
+	p.ctrlMu.Lock()
+	p.mode = mode
+	p.ctrlMu.Unlock()
+}
+
+func (p *audioPlayer) getMode() playbackMode {
+	p.ctrlMu.Lock()
+	defer p.ctrlMu.Unlock()
+	return p.mode
+}
+
+// libraryChanged drops the prefetched track so the next one is chosen from
+// the new file list right away.
+func (p *audioPlayer) libraryChanged() {
+	p.queue.flush()
+	select {
+	case p.changedCh <- struct{}{}:
+	default:
 	}
-	defer f.Close()
+}
+
+func (p *audioPlayer) waitForChange(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	case <-p.changedCh:
+	}
+}
+
+func (p *audioPlayer) setPlaylist(name string) {
+	p.ctrlMu.Lock()
+	p.playlist = name
+	p.ctrlMu.Unlock()
+}
 
-	streamer, format, err := decodeAudio(f, path)
+// entries returns the active playlist, or every file in the audio folder
+// when no playlist is active or it cannot be read.
+func (p *audioPlayer) entries() (string, []playlistEntry, error) {
+	p.ctrlMu.Lock()
+	name := p.playlist
+	p.ctrlMu.Unlock()
+
+	if name != "" {
+		entries, err := loadPlaylist(p.playlistDir, name)
+		if err == nil {
+			p.playlistErr = ""
+			return name, entries, nil
+		}
+		if err.Error() != p.playlistErr {
+			p.playlistErr = err.Error()
+			log.Printf("playlist error, playing all files: %v", err)
+		}
+	}
+	files, err := listAudioFiles(p.dir)
 	if err != nil {
-		return err
+		return "", nil, err
+	}
+	return "", libraryEntries(files), nil
+}
+
+func (p *audioPlayer) openTrack(path string, start time.Duration, gainDB float64) (*track, error) {
+	var (
+		file     io.Closer
+		streamer beep.StreamSeekCloser
+		format   beep.Format
+	)
+	if isGenerator(path) {
+		var err error
+		streamer, format, err = openGenerator(path, p.baseSampleRate)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		streamer, format, err = decodeAudio(f, path)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		file = f
+	}
+
+	if start > 0 {
+		if n := format.SampleRate.N(start); n < streamer.Len() {
+			if err := streamer.Seek(n); err != nil {
+				log.Printf("audio seek error: %s: %v", filepath.Base(path), err)
+			}
+		}
 	}
-	defer streamer.Close()
 
 	if p.baseSampleRate == 0 {
-		speaker.Init(format.SampleRate, format.SampleRate.N(time.Second/10))
-		p.baseSampleRate = format.SampleRate
+		p.startOutput(format.SampleRate)
 	}
 
 	finalStreamer := beep.Streamer(streamer)
 	if format.SampleRate != p.baseSampleRate {
 		finalStreamer = beep.Resample(4, format.SampleRate, p.baseSampleRate, finalStreamer)
 	}
-
-	ctrl := &beep.Ctrl{Streamer: finalStreamer, Paused: p.isPaused()}
 	p.ctrlMu.Lock()
-	p.ctrl = ctrl
+	loudness := p.loudness
 	p.ctrlMu.Unlock()
-
-	select {
-	case p.fileStartedCh <- filepath.Base(path):
-	default:
+	if loudness != nil && !isGenerator(path) {
+		gainDB += loudness.gain(path)
 	}
-
-	done := make(chan struct{})
-	speaker.Play(beep.Seq(ctrl, beep.Callback(func() {
-		close(done)
-	})))
-
-	select {
-	case <-ctx.Done():
-		return ctx.Err()
-	case <-done:
-		return nil
+	if gainDB != 0 {
+		finalStreamer = &effects.Volume{Streamer: finalStreamer, Base: 10, Volume: gainDB / 20}
 	}
+	return &track{
+		path:    path,
+		file:    file,
+		decoder: streamer,
+		format:  format,
+		stream:  finalStreamer,
+		ratio:   float64(p.baseSampleRate) / float64(format.SampleRate),
+	}, nil
 }
 
-func decodeAudio(r io.ReadSeeker, path string) (beep.StreamSeekCloser, beep.Format, error) {
-	switch strings.ToLower(filepath.Ext(path)) {
-	case ".mp3":
-		return mp3.Decode(io.NopCloser(r))
-	case ".wav":
-		return wav.Decode(io.NopCloser(r))
-	default:
-		return nil, beep.Format{}, fmt.Errorf("unsupported audio format: %s", path)
+func (p *audioPlayer) startOutput(rate beep.SampleRate) {
+	if err := p.output.Init(rate); err != nil {
+		log.Printf("audio output error: %v", err)
 	}
-}
 
-func listAudioFiles(dir string) ([]string, error) {
-	entries, err := os.ReadDir(dir)
+	p.ctrlMu.Lock()
+	p.baseSampleRate = rate
+	p.queue.setCrossfade(rate.N(p.crossfade))
+	stages, err := buildDSPStages(p.dspPresets[p.dspPreset], float64(rate))
 	if err != nil {
-		return nil, err
-	}
-	var files []string
-	for _, entry := range entries {
-		if entry.IsDir() {
-			continue
-		}
-		ext := strings.ToLower(filepath.Ext(entry.Name()))
-		if ext == ".mp3" || ext == ".wav" {
-			files = append(files, filepath.Join(dir, entry.Name()))
-		}
+		log.Printf("dsp error: %v", err)
 	}
-	sort.Strings(files)
-	return files, nil
+	dsp := &dspChain{Streamer: p.queue, stages: stages}
+	gain := &effects.Volume{Streamer: dsp}
+	applyVolume(gain, p.effectiveVolumeLocked())
+	fade := newFader(gain, p.isPaused(), rate.N(p.fadeIn), rate.N(p.fadeOut))
+	p.dsp = dsp
+	p.gain = gain
+	p.fader = fade
+	p.ctrlMu.Unlock()
+
+	p.output.Play(fade)
 }
 
-func nextFileIndex(files []string, lastPlayed string) int {
-	if len(files) == 0 {
-		return 0
-	}
-	if lastPlayed == "" {
-		return 0
-	}
-	for i, file := range files {
-		if file == lastPlayed {
-			return (i + 1) % len(files)
-		}
+func listAudioFiles(dir string) ([]string, error) {
+	files, err := scanAudioFiles(dir)
+	if err != nil {
+		return nil, err
 	}
-	return 0
+	files = append(files, generatorPaths(appConfig.Generators)...)
+	return applyLibraryOrder(files, readLibraryOrder(dir)), nil
 }
@@ -0,0 +1,76 @@
+package main
+
+import "math"
+
+// biquad is a second-order IIR section in transposed direct form II with
+// separate state for the two channels.
+type biquad struct {
+	b0, b1, b2 float64
+	a1, a2     float64
+	z1, z2     [2]float64
+}
+
+func (f *biquad) process(x float64, ch int) float64 {
+	y := f.b0*x + f.z1[ch]
+	f.z1[ch] = f.b1*x - f.a1*y + f.z2[ch]
+	f.z2[ch] = f.b2*x - f.a2*y
+	return y
+}
+
+func newBiquad(b0, b1, b2, a0, a1, a2 float64) *biquad {
+	return &biquad{b0: b0 / a0, b1: b1 / a0, b2: b2 / a0, a1: a1 / a0, a2: a2 / a0}
+}
+
+// kWeighting returns the two filter stages of ITU-R BS.1770 for the given
+// sample rate.
+func kWeighting(rate float64) [2]*biquad {
+	k := math.Tan(math.Pi * 1681.974450955533 / rate)
+	q := 0.7071752369554196
+	vh := math.Pow(10, 3.999843853973347/20)
+	vb := math.Pow(vh, 0.4996667741545416)
+	shelf := newBiquad(
+		vh+vb*k/q+k*k, 2*(k*k-vh), vh-vb*k/q+k*k,
+		1+k/q+k*k, 2*(k*k-1), 1-k/q+k*k,
+	)
+
+	k = math.Tan(math.Pi * 38.13547087602444 / rate)
+	q = 0.5003270373238773
+	// The reference filter keeps b = (1, -2, 1) unnormalized.
+	a0 := 1 + k/q + k*k
+	highPass := &biquad{b0: 1, b1: -2, b2: 1, a1: 2 * (k*k - 1) / a0, a2: (1 - k/q + k*k) / a0}
+	return [2]*biquad{shelf, highPass}
+}
+
+// The constructors below follow the Audio EQ Cookbook (R. Bristow-Johnson).
+
+func lowPass(rate, freq, q float64) *biquad {
+	w, alpha := cookbookParams(rate, freq, q)
+	c := math.Cos(w)
+	return newBiquad((1-c)/2, 1-c, (1-c)/2, 1+alpha, -2*c, 1-alpha)
+}
+
+func highPass(rate, freq, q float64) *biquad {
+	w, alpha := cookbookParams(rate, freq, q)
+	c := math.Cos(w)
+	return newBiquad((1+c)/2, -(1 + c), (1+c)/2, 1+alpha, -2*c, 1-alpha)
+}
+
+func bandPass(rate, freq, q float64) *biquad {
+	w, alpha := cookbookParams(rate, freq, q)
+	c := math.Cos(w)
+	return newBiquad(alpha, 0, -alpha, 1+alpha, -2*c, 1-alpha)
+}
+
+func peakingEQ(rate, freq, q, gainDB float64) *biquad {
+	w, alpha := cookbookParams(rate, freq, q)
+	c := math.Cos(w)
+	a := math.Pow(10, gainDB/40)
+	return newBiquad(1+alpha*a, -2*c, 1-alpha*a, 1+alpha/a, -2*c, 1-alpha/a)
+}
+
+func cookbookParams(rate, freq, q float64) (w, alpha float64) {
+	// Keep the corner below Nyquist for low output rates.
+	freq = min(freq, 0.45*rate)
+	w = 2 * math.Pi * freq / rate
+	return w, math.Sin(w) / (2 * q)
+}
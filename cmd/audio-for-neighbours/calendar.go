@@ -0,0 +1,459 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/teambition/rrule-go"
+)
+
+type CalendarConfig struct {
+	Path string `yaml:"path"`
+	Mode string `yaml:"mode"`
+}
+
+const (
+	calendarModeQuiet = "quiet"
+	calendarModePlay  = "play"
+)
+
+type calendarEvent struct {
+	uid      string
+	summary  string
+	start    time.Time
+	duration time.Duration
+	set      *rrule.Set
+}
+
+type calendarOccurrence struct {
+	summary string
+	mode    string
+	start   time.Time
+	end     time.Time
+}
+
+type calendarSource struct {
+	path    string
+	mode    string
+	modTime time.Time
+	events  []calendarEvent
+}
+
+type calendarSet struct {
+	mu      sync.Mutex
+	loc     *time.Location
+	sources []*calendarSource
+}
+
+func validateCalendars(cfgs []CalendarConfig) error {
+	for _, cfg := range cfgs {
+		if cfg.Path == "" {
+			return fmt.Errorf("calendar path is empty")
+		}
+		switch cfg.Mode {
+		case calendarModeQuiet, calendarModePlay:
+		default:
+			return fmt.Errorf("calendar %s: invalid mode %q (want quiet or play)", cfg.Path, cfg.Mode)
+		}
+	}
+	return nil
+}
+
+func newCalendarSet(cfgs []CalendarConfig, loc *time.Location) *calendarSet {
+	c := &calendarSet{loc: loc}
+	for _, cfg := range cfgs {
+		c.sources = append(c.sources, &calendarSource{path: cfg.Path, mode: cfg.Mode})
+	}
+	c.reload()
+	return c
+}
+
+func (c *calendarSet) reload() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, src := range c.sources {
+		info, err := os.Stat(src.path)
+		if err != nil {
+			log.Printf("calendar %s: %v", src.path, err)
+			continue
+		}
+		if info.ModTime().Equal(src.modTime) {
+			continue
+		}
+		events, err := loadICSFile(src.path, c.loc)
+		if err != nil {
+			log.Printf("calendar %s: %v", src.path, err)
+			continue
+		}
+		src.modTime = info.ModTime()
+		src.events = events
+		log.Printf("calendar %s: loaded %d events", src.path, len(events))
+	}
+}
+
+func (c *calendarSet) sourceCount() int {
+	if c == nil {
+		return 0
+	}
+	return len(c.sources)
+}
+
+func (c *calendarSet) eventCount() int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	count := 0
+	for _, src := range c.sources {
+		count += len(src.events)
+	}
+	return count
+}
+
+func (c *calendarSet) activeAt(t time.Time) []calendarOccurrence {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var active []calendarOccurrence
+	for _, src := range c.sources {
+		for _, evt := range src.events {
+			for _, start := range evt.set.Between(t.Add(-evt.duration), t, true) {
+				end := start.Add(evt.duration)
+				if !start.After(t) && t.Before(end) {
+					active = append(active, calendarOccurrence{summary: evt.summary, mode: src.mode, start: start, end: end})
+				}
+			}
+		}
+	}
+	return active
+}
+
+func (c *calendarSet) boundaries(from, until time.Time) []time.Time {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var out []time.Time
+	for _, src := range c.sources {
+		for _, evt := range src.events {
+			for _, start := range evt.set.Between(from.Add(-evt.duration), until, true) {
+				for _, b := range []time.Time{start, start.Add(evt.duration)} {
+					if b.After(from) && !b.After(until) {
+						out = append(out, b)
+					}
+				}
+			}
+		}
+	}
+	return out
+}
+
+func loadICSFile(path string, loc *time.Location) ([]calendarEvent, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseICS(f, loc)
+}
+
+type icsProperty struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+func parseICS(r io.Reader, loc *time.Location) ([]calendarEvent, error) {
+	lines, err := unfoldICSLines(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		events    []calendarEvent
+		overrides = make(map[string][]time.Time)
+		current   []icsProperty
+		inEvent   bool
+		depth     int
+	)
+	for _, line := range lines {
+		prop, ok := parseICSLine(line)
+		if !ok {
+			continue
+		}
+		switch {
+		case prop.name == "BEGIN" && strings.EqualFold(prop.value, "VEVENT"):
+			inEvent = true
+			depth = 0
+			current = nil
+		case inEvent && prop.name == "BEGIN":
+			depth++
+		case inEvent && prop.name == "END" && depth > 0:
+			depth--
+		case inEvent && prop.name == "END" && strings.EqualFold(prop.value, "VEVENT"):
+			inEvent = false
+			evt, recurrenceID, err := buildCalendarEvent(current, loc)
+			if err != nil {
+				log.Printf("calendar: skip event: %v", err)
+				continue
+			}
+			if evt == nil {
+				continue
+			}
+			if !recurrenceID.IsZero() {
+				overrides[evt.uid] = append(overrides[evt.uid], recurrenceID)
+				rs := &rrule.Set{}
+				rs.RDate(evt.start)
+				evt.set = rs
+			}
+			events = append(events, *evt)
+		case inEvent && depth == 0:
+			current = append(current, prop)
+		}
+	}
+
+	for i := range events {
+		evt := &events[i]
+		if evt.set.GetRRule() == nil {
+			continue
+		}
+		for _, t := range overrides[evt.uid] {
+			evt.set.ExDate(t)
+		}
+	}
+	return events, nil
+}
+
+func unfoldICSLines(r io.Reader) ([]string, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	var lines []string
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, scanner.Err()
+}
+
+func parseICSLine(line string) (icsProperty, bool) {
+	inQuote := false
+	colon := -1
+	for i := 0; i < len(line); i++ {
+		if line[i] == '"' {
+			inQuote = !inQuote
+		}
+		if line[i] == ':' && !inQuote {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		return icsProperty{}, false
+	}
+
+	parts := strings.Split(line[:colon], ";")
+	prop := icsProperty{
+		name:   strings.ToUpper(strings.TrimSpace(parts[0])),
+		params: make(map[string]string),
+		value:  line[colon+1:],
+	}
+	for _, param := range parts[1:] {
+		key, value, ok := strings.Cut(param, "=")
+		if !ok {
+			continue
+		}
+		prop.params[strings.ToUpper(key)] = strings.Trim(value, `"`)
+	}
+	return prop, true
+}
+
+func buildCalendarEvent(props []icsProperty, loc *time.Location) (*calendarEvent, time.Time, error) {
+	evt := &calendarEvent{}
+	var (
+		end          time.Time
+		allDay       bool
+		hasDuration  bool
+		ruleValue    string
+		exdates      []time.Time
+		rdates       []time.Time
+		recurrenceID time.Time
+	)
+
+	for _, prop := range props {
+		switch prop.name {
+		case "UID":
+			evt.uid = prop.value
+		case "SUMMARY":
+			evt.summary = unescapeICSText(prop.value)
+		case "STATUS":
+			if strings.EqualFold(prop.value, "CANCELLED") {
+				return nil, time.Time{}, nil
+			}
+		case "DTSTART":
+			t, date, err := parseICSTime(prop, loc)
+			if err != nil {
+				return nil, time.Time{}, err
+			}
+			evt.start = t
+			allDay = date
+		case "DTEND":
+			t, _, err := parseICSTime(prop, loc)
+			if err != nil {
+				return nil, time.Time{}, err
+			}
+			end = t
+		case "DURATION":
+			d, err := parseICSDuration(prop.value)
+			if err != nil {
+				return nil, time.Time{}, err
+			}
+			evt.duration = d
+			hasDuration = true
+		case "RRULE":
+			ruleValue = prop.value
+		case "EXDATE", "RDATE":
+			for _, value := range strings.Split(prop.value, ",") {
+				t, _, err := parseICSTime(icsProperty{params: prop.params, value: value}, loc)
+				if err != nil {
+					return nil, time.Time{}, err
+				}
+				if prop.name == "EXDATE" {
+					exdates = append(exdates, t)
+				} else {
+					rdates = append(rdates, t)
+				}
+			}
+		case "RECURRENCE-ID":
+			t, _, err := parseICSTime(prop, loc)
+			if err != nil {
+				return nil, time.Time{}, err
+			}
+			recurrenceID = t
+		}
+	}
+
+	if evt.start.IsZero() {
+		return nil, time.Time{}, fmt.Errorf("event %q has no DTSTART", evt.summary)
+	}
+	if !hasDuration {
+		switch {
+		case !end.IsZero():
+			evt.duration = end.Sub(evt.start)
+		case allDay:
+			evt.duration = 24 * time.Hour
+		}
+	}
+	if evt.duration <= 0 {
+		return nil, time.Time{}, fmt.Errorf("event %q has no duration", evt.summary)
+	}
+
+	set := &rrule.Set{}
+	if ruleValue != "" && recurrenceID.IsZero() {
+		opt, err := rrule.StrToROptionInLocation(ruleValue, evt.start.Location())
+		if err != nil {
+			return nil, time.Time{}, fmt.Errorf("event %q: %w", evt.summary, err)
+		}
+		opt.Dtstart = evt.start
+		rule, err := rrule.NewRRule(*opt)
+		if err != nil {
+			return nil, time.Time{}, fmt.Errorf("event %q: %w", evt.summary, err)
+		}
+		set.RRule(rule)
+	} else {
+		set.RDate(evt.start)
+	}
+	for _, t := range rdates {
+		set.RDate(t)
+	}
+	for _, t := range exdates {
+		set.ExDate(t)
+	}
+	evt.set = set
+	return evt, recurrenceID, nil
+}
+
+func parseICSTime(prop icsProperty, loc *time.Location) (time.Time, bool, error) {
+	value := strings.TrimSpace(prop.value)
+	if prop.params["VALUE"] == "DATE" || len(value) == 8 {
+		t, err := time.ParseInLocation("20060102", value, loc)
+		return t, true, err
+	}
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse("20060102T150405Z", value)
+		return t, false, err
+	}
+	tzLoc := loc
+	if tzid := prop.params["TZID"]; tzid != "" {
+		if l, err := time.LoadLocation(tzid); err == nil {
+			tzLoc = l
+		}
+	}
+	t, err := time.ParseInLocation("20060102T150405", value, tzLoc)
+	return t, false, err
+}
+
+var reICSDuration = regexp.MustCompile(`^([+-])?P(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+
+func parseICSDuration(value string) (time.Duration, error) {
+	m := reICSDuration.FindStringSubmatch(strings.TrimSpace(value))
+	if m == nil {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+	units := []time.Duration{7 * 24 * time.Hour, 24 * time.Hour, time.Hour, time.Minute, time.Second}
+	var d time.Duration
+	for i, unit := range units {
+		if m[i+2] == "" {
+			continue
+		}
+		n, err := strconv.Atoi(m[i+2])
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q: %w", value, err)
+		}
+		d += time.Duration(n) * unit
+	}
+	if m[1] == "-" {
+		d = -d
+	}
+	return d, nil
+}
+
+func unescapeICSText(value string) string {
+	return strings.NewReplacer(`\n`, " ", `\N`, " ", `\,`, ",", `\;`, ";", `\\`, `\`).Replace(value)
+}
+
+func describeOccurrences(occ []calendarOccurrence) string {
+	sort.Slice(occ, func(i, j int) bool { return occ[i].start.Before(occ[j].start) })
+	var names []string
+	for _, o := range occ {
+		name := o.summary
+		if name == "" {
+			name = "untitled"
+		}
+		names = append(names, name)
+	}
+	return strings.Join(names, ", ")
+}
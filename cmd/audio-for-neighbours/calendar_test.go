@@ -0,0 +1,261 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func ics(lines ...string) string {
+	return "BEGIN:VCALENDAR\r\nVERSION:2.0\r\n" + strings.Join(lines, "\r\n") + "\r\nEND:VCALENDAR\r\n"
+}
+
+// occurrences lists every occurrence between from and until as
+// "summary start duration", start in UTC.
+func occurrences(t *testing.T, events []calendarEvent, from, until time.Time) []string {
+	t.Helper()
+	var out []string
+	for _, evt := range events {
+		for _, start := range evt.set.Between(from, until, true) {
+			out = append(out, evt.summary+" "+start.UTC().Format("2006-01-02T15:04")+" "+evt.duration.String())
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+func parseICSString(t *testing.T, data string, loc *time.Location) []calendarEvent {
+	t.Helper()
+	events, err := parseICS(strings.NewReader(data), loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return events
+}
+
+func mustLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skipf("time zone data not available: %v", err)
+	}
+	return loc
+}
+
+func TestParseICS(t *testing.T) {
+	berlin := mustLocation(t, "Europe/Berlin")
+	from := time.Date(2026, time.September, 1, 0, 0, 0, 0, time.UTC)
+	until := time.Date(2026, time.December, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, tc := range []struct {
+		name string
+		data string
+		want []string
+	}{
+		{
+			name: "weekly rule with TZID, EXDATE, RDATE and a folded summary",
+			data: ics(
+				"BEGIN:VEVENT",
+				"UID:choir",
+				"SUMMARY:Choir",
+				"  practice",
+				"DTSTART;TZID=Europe/Berlin:20261005T180000",
+				"DTEND;TZID=Europe/Berlin:20261005T200000",
+				"RRULE:FREQ=WEEKLY;COUNT=4",
+				"EXDATE;TZID=Europe/Berlin:20261012T180000",
+				"RDATE;TZID=Europe/Berlin:20261015T090000",
+				"END:VEVENT",
+			),
+			// 18:00 in Berlin is 16:00 UTC before the switch to winter time
+			// on 25 October and 17:00 UTC after it.
+			want: []string{
+				"Choir practice 2026-10-05T16:00 2h0m0s",
+				"Choir practice 2026-10-15T07:00 2h0m0s",
+				"Choir practice 2026-10-19T16:00 2h0m0s",
+				"Choir practice 2026-10-26T17:00 2h0m0s",
+			},
+		},
+		{
+			name: "recurrence override moves one instance",
+			data: ics(
+				"BEGIN:VEVENT",
+				"UID:standup",
+				"SUMMARY:Standup",
+				"DTSTART:20261005T100000Z",
+				"DURATION:PT15M",
+				"RRULE:FREQ=DAILY;COUNT=3",
+				"END:VEVENT",
+				"BEGIN:VEVENT",
+				"UID:standup",
+				"SUMMARY:Standup",
+				"RECURRENCE-ID:20261006T100000Z",
+				"DTSTART:20261006T150000Z",
+				"DURATION:PT30M",
+				"END:VEVENT",
+			),
+			want: []string{
+				"Standup 2026-10-05T10:00 15m0s",
+				"Standup 2026-10-06T15:00 30m0s",
+				"Standup 2026-10-07T10:00 15m0s",
+			},
+		},
+		{
+			name: "cancelled events and events without a start are skipped",
+			data: ics(
+				"BEGIN:VEVENT",
+				"UID:party",
+				"SUMMARY:Party",
+				"STATUS:CANCELLED",
+				"DTSTART:20261010T200000Z",
+				"DTEND:20261010T230000Z",
+				"END:VEVENT",
+				"BEGIN:VEVENT",
+				"UID:broken",
+				"SUMMARY:Broken",
+				"DTEND:20261010T230000Z",
+				"END:VEVENT",
+				"BEGIN:VEVENT",
+				"UID:kept",
+				"SUMMARY:Kept",
+				"DTSTART:20261011T200000Z",
+				"DTEND:20261011T210000Z",
+				"END:VEVENT",
+			),
+			want: []string{"Kept 2026-10-11T20:00 1h0m0s"},
+		},
+		{
+			name: "all-day events use the schedule time zone",
+			data: ics(
+				"BEGIN:VEVENT",
+				"UID:holiday",
+				"SUMMARY:Unity Day",
+				"DTSTART;VALUE=DATE:20261003",
+				"END:VEVENT",
+				"BEGIN:VEVENT",
+				"UID:trip",
+				"SUMMARY:Trip",
+				"DTSTART;VALUE=DATE:20261030",
+				"DTEND;VALUE=DATE:20261101",
+				"END:VEVENT",
+			),
+			want: []string{
+				"Trip 2026-10-29T23:00 48h0m0s",
+				"Unity Day 2026-10-02T22:00 24h0m0s",
+			},
+		},
+		{
+			name: "timed events without a zone use the schedule time zone",
+			data: ics(
+				"BEGIN:VEVENT",
+				"UID:floating",
+				"SUMMARY:Floating",
+				"DTSTART:20261020T083000",
+				"DURATION:PT1H30M",
+				"END:VEVENT",
+				"BEGIN:VEVENT",
+				"UID:tokyo",
+				"SUMMARY:Tokyo call",
+				"DTSTART;TZID=Asia/Tokyo:20261020T090000",
+				"DTEND;TZID=Asia/Tokyo:20261020T100000",
+				"END:VEVENT",
+			),
+			want: []string{
+				"Floating 2026-10-20T06:30 1h30m0s",
+				"Tokyo call 2026-10-20T00:00 1h0m0s",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := occurrences(t, parseICSString(t, tc.data, berlin), from, until)
+			if strings.Join(got, "\n") != strings.Join(tc.want, "\n") {
+				t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tc.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestParseICSText(t *testing.T) {
+	events := parseICSString(t, ics(
+		"BEGIN:VEVENT",
+		"UID:x",
+		`SUMMARY:Tea\, cake \; songs\nlater`,
+		"DTSTART:20261010T100000Z",
+		"DURATION:PT1H",
+		"BEGIN:VALARM",
+		"TRIGGER:-PT15M",
+		"DESCRIPTION:Reminder",
+		"END:VALARM",
+		"END:VEVENT",
+	), time.UTC)
+	if len(events) != 1 || events[0].summary != "Tea, cake ; songs later" {
+		t.Fatalf("events = %+v", events)
+	}
+}
+
+func TestCalendarSetActiveAt(t *testing.T) {
+	dir := t.TempDir()
+	quiet := filepath.Join(dir, "holidays.ics")
+	play := filepath.Join(dir, "parties.ics")
+	write := func(path, data string) {
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(quiet, ics(
+		"BEGIN:VEVENT",
+		"UID:h",
+		"SUMMARY:Holiday",
+		"DTSTART;VALUE=DATE:20261003",
+		"RRULE:FREQ=YEARLY",
+		"END:VEVENT",
+	))
+	write(play, ics(
+		"BEGIN:VEVENT",
+		"UID:p",
+		"SUMMARY:Party",
+		"DTSTART:20261003T180000Z",
+		"DTEND:20261003T220000Z",
+		"END:VEVENT",
+	))
+	set := newCalendarSet([]CalendarConfig{{Path: quiet, Mode: calendarModeQuiet}, {Path: play, Mode: calendarModePlay}}, time.UTC)
+	if set.eventCount() != 2 {
+		t.Fatalf("loaded %d events, want 2", set.eventCount())
+	}
+
+	describe := func(at time.Time) string {
+		var out []string
+		for _, occ := range set.activeAt(at) {
+			out = append(out, occ.mode+":"+occ.summary)
+		}
+		sort.Strings(out)
+		return strings.Join(out, ",")
+	}
+	for _, tc := range []struct {
+		at   time.Time
+		want string
+	}{
+		{time.Date(2026, time.October, 2, 23, 59, 0, 0, time.UTC), ""},
+		{time.Date(2026, time.October, 3, 0, 0, 0, 0, time.UTC), "quiet:Holiday"},
+		{time.Date(2026, time.October, 3, 19, 0, 0, 0, time.UTC), "play:Party,quiet:Holiday"},
+		{time.Date(2026, time.October, 3, 22, 0, 0, 0, time.UTC), "quiet:Holiday"},
+		{time.Date(2026, time.October, 4, 0, 0, 0, 0, time.UTC), ""},
+		{time.Date(2027, time.October, 3, 12, 0, 0, 0, time.UTC), "quiet:Holiday"},
+	} {
+		if got := describe(tc.at); got != tc.want {
+			t.Errorf("%s: active %q, want %q", tc.at.Format(time.RFC3339), got, tc.want)
+		}
+	}
+
+	from := time.Date(2026, time.October, 3, 12, 0, 0, 0, time.UTC)
+	var got []string
+	for _, b := range set.boundaries(from, from.Add(24*time.Hour)) {
+		got = append(got, b.UTC().Format("02T15:04"))
+	}
+	sort.Strings(got)
+	if want := "03T18:00,03T22:00,04T00:00"; strings.Join(got, ",") != want {
+		t.Errorf("boundaries = %v, want %s", got, want)
+	}
+}
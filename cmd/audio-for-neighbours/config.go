@@ -9,16 +9,37 @@ import (
 )
 
 type Config struct {
-	AudioDir           string         `yaml:"audio_dir"`
-	PullTimeout        string         `yaml:"pull_timeout"`
-	MessageLimit       int            `yaml:"message_limit"`
-	MotionResumeDelay  time.Duration  `yaml:"-"`
-	PresenceClearDelay time.Duration  `yaml:"-"`
-	UseWSSecurity      bool           `yaml:"use_ws_security"`
-	PresenceTargets    []string       `yaml:"presence_targets"`
-	Camera             CameraConfig   `yaml:"camera"`
-	Router             RouterConfig   `yaml:"router"`
-	Telegram           TelegramConfig `yaml:"telegram"`
+	AudioDir           string            `yaml:"audio_dir"`
+	PlaylistDir        string            `yaml:"playlist_dir"`
+	Volume             int               `yaml:"volume"`
+	PlaybackMode       playbackMode      `yaml:"-"`
+	PullTimeout        string            `yaml:"pull_timeout"`
+	MessageLimit       int               `yaml:"message_limit"`
+	MotionResumeDelay  time.Duration     `yaml:"-"`
+	PresenceClearDelay time.Duration     `yaml:"-"`
+	UseWSSecurity      bool              `yaml:"use_ws_security"`
+	PresenceTargets    []string          `yaml:"presence_targets"`
+	FadeIn             time.Duration     `yaml:"-"`
+	FadeOut            time.Duration     `yaml:"-"`
+	Crossfade          time.Duration     `yaml:"-"`
+	InstantManualPause bool              `yaml:"-"`
+	Schedule           *weeklySchedule   `yaml:"-"`
+	Calendars          []CalendarConfig  `yaml:"calendars"`
+	Camera             CameraConfig      `yaml:"camera"`
+	Router             RouterConfig      `yaml:"router"`
+	Telegram           TelegramConfig    `yaml:"telegram"`
+	Notifiers          []NotifierConfig  `yaml:"notifiers"`
+	MQTT               MQTTConfig        `yaml:"mqtt"`
+	HTTP               HTTPConfig        `yaml:"http"`
+	StateFile          string            `yaml:"state_file"`
+	JournalFile        string            `yaml:"journal_file"`
+	Loudness           bool              `yaml:"-"`
+	LoudnessTarget     float64           `yaml:"-"`
+	LoudnessMaxBoost   float64           `yaml:"-"`
+	LoudnessFile       string            `yaml:"-"`
+	DSP                DSPConfig         `yaml:"dsp"`
+	Generators         []GeneratorConfig `yaml:"generators"`
+	Output             OutputConfig      `yaml:"output"`
 }
 
 type CameraConfig struct {
@@ -35,23 +56,73 @@ type RouterConfig struct {
 }
 
 type TelegramConfig struct {
-	Token  string `yaml:"token"`
-	ChatID int64  `yaml:"chat_id"`
+	Token  string               `yaml:"token"`
+	ChatID int64                `yaml:"chat_id"`
+	Chats  []TelegramChatConfig `yaml:"chats"`
+	Users  []TelegramUserConfig `yaml:"users"`
+	FFmpeg string               `yaml:"ffmpeg"`
+}
+
+type TelegramChatConfig struct {
+	ID     int64    `yaml:"id"`
+	Role   string   `yaml:"role"`
+	Events []string `yaml:"events"`
+}
+
+type TelegramUserConfig struct {
+	ID   int64  `yaml:"id"`
+	Role string `yaml:"role"`
+}
+
+type LoudnessConfig struct {
+	Enabled   bool     `yaml:"enabled"`
+	Target    *float64 `yaml:"target"`
+	MaxBoost  *float64 `yaml:"max_boost"`
+	CacheFile string   `yaml:"cache_file"`
+}
+
+type FadeConfig struct {
+	In                 string `yaml:"in"`
+	Out                string `yaml:"out"`
+	Crossfade          string `yaml:"crossfade"`
+	InstantManualPause bool   `yaml:"instant_manual_pause"`
 }
 
 type rawConfig struct {
-	AudioDir           string         `yaml:"audio_dir"`
-	PullTimeout        string         `yaml:"pull_timeout"`
-	MessageLimit       int            `yaml:"message_limit"`
-	MotionResumeDelay  string         `yaml:"motion_resume_delay"`
-	PresenceClearDelay string         `yaml:"presence_clear_delay"`
-	UseWSSecurity      bool           `yaml:"use_ws_security"`
-	PresenceTargets    []string       `yaml:"presence_targets"`
-	Camera             CameraConfig   `yaml:"camera"`
-	Router             RouterConfig   `yaml:"router"`
-	Telegram           TelegramConfig `yaml:"telegram"`
+	AudioDir           string            `yaml:"audio_dir"`
+	PlaylistDir        string            `yaml:"playlist_dir"`
+	Volume             *int              `yaml:"volume"`
+	PlaybackMode       string            `yaml:"playback_mode"`
+	PullTimeout        string            `yaml:"pull_timeout"`
+	MessageLimit       int               `yaml:"message_limit"`
+	MotionResumeDelay  string            `yaml:"motion_resume_delay"`
+	PresenceClearDelay string            `yaml:"presence_clear_delay"`
+	UseWSSecurity      bool              `yaml:"use_ws_security"`
+	PresenceTargets    []string          `yaml:"presence_targets"`
+	Fade               FadeConfig        `yaml:"fade"`
+	Schedule           ScheduleConfig    `yaml:"schedule"`
+	Calendars          []CalendarConfig  `yaml:"calendars"`
+	Camera             CameraConfig      `yaml:"camera"`
+	Router             RouterConfig      `yaml:"router"`
+	Telegram           TelegramConfig    `yaml:"telegram"`
+	Notifiers          []NotifierConfig  `yaml:"notifiers"`
+	MQTT               MQTTConfig        `yaml:"mqtt"`
+	HTTP               HTTPConfig        `yaml:"http"`
+	StateFile          string            `yaml:"state_file"`
+	JournalFile        string            `yaml:"journal_file"`
+	Loudness           LoudnessConfig    `yaml:"loudness"`
+	DSP                DSPConfig         `yaml:"dsp"`
+	Generators         []GeneratorConfig `yaml:"generators"`
+	Output             OutputConfig      `yaml:"output"`
 }
 
+const configPath = "config.yaml"
+
+const (
+	defaultFadeIn  = 2 * time.Second
+	defaultFadeOut = time.Second
+)
+
 var appConfig Config
 
 func loadConfig(path string) (Config, error) {
@@ -79,17 +150,122 @@ func loadConfig(path string) (Config, error) {
 			return Config{}, fmt.Errorf("invalid presence_clear_delay: %w", err)
 		}
 	}
+	fadeIn, err := parseOptionalDuration(raw.Fade.In, defaultFadeIn)
+	if err != nil {
+		return Config{}, fmt.Errorf("invalid fade.in: %w", err)
+	}
+	fadeOut, err := parseOptionalDuration(raw.Fade.Out, defaultFadeOut)
+	if err != nil {
+		return Config{}, fmt.Errorf("invalid fade.out: %w", err)
+	}
+	crossfade, err := parseOptionalDuration(raw.Fade.Crossfade, 0)
+	if err != nil {
+		return Config{}, fmt.Errorf("invalid fade.crossfade: %w", err)
+	}
+	volume := 100
+	if raw.Volume != nil {
+		volume = *raw.Volume
+		if volume < 0 || volume > 100 {
+			return Config{}, fmt.Errorf("invalid volume %d, expected 0-100", volume)
+		}
+	}
+	mode, err := parsePlaybackMode(raw.PlaybackMode)
+	if err != nil {
+		return Config{}, err
+	}
+	schedule, err := parseSchedule(raw.Schedule)
+	if err != nil {
+		return Config{}, err
+	}
+	if err := validateCalendars(raw.Calendars); err != nil {
+		return Config{}, err
+	}
+	if _, _, err := parseTelegramAccess(raw.Telegram); err != nil {
+		return Config{}, err
+	}
+	if err := validateNotifiers(raw.Notifiers); err != nil {
+		return Config{}, err
+	}
+	if err := validateDSP(raw.DSP); err != nil {
+		return Config{}, err
+	}
+	if err := validateGenerators(raw.Generators); err != nil {
+		return Config{}, err
+	}
+	if _, err := newOutput(raw.Output); err != nil {
+		return Config{}, err
+	}
+
+	playlistDir := raw.PlaylistDir
+	if playlistDir == "" {
+		playlistDir = raw.AudioDir
+	}
+	stateFile := raw.StateFile
+	if stateFile == "" {
+		stateFile = defaultStateFile
+	}
+	journalFile := raw.JournalFile
+	if journalFile == "" {
+		journalFile = defaultJournalFile
+	}
+	loudnessTarget := defaultLoudnessTarget
+	if raw.Loudness.Target != nil {
+		loudnessTarget = *raw.Loudness.Target
+	}
+	loudnessMaxBoost := defaultLoudnessMaxBoost
+	if raw.Loudness.MaxBoost != nil {
+		loudnessMaxBoost = *raw.Loudness.MaxBoost
+	}
+	loudnessFile := raw.Loudness.CacheFile
+	if loudnessFile == "" {
+		loudnessFile = defaultLoudnessFile
+	}
 
 	return Config{
 		AudioDir:           raw.AudioDir,
+		PlaylistDir:        playlistDir,
+		Volume:             volume,
+		PlaybackMode:       mode,
 		PullTimeout:        raw.PullTimeout,
 		MessageLimit:       raw.MessageLimit,
 		MotionResumeDelay:  delay,
 		PresenceClearDelay: presenceDelay,
 		UseWSSecurity:      raw.UseWSSecurity,
 		PresenceTargets:    raw.PresenceTargets,
+		FadeIn:             fadeIn,
+		FadeOut:            fadeOut,
+		Crossfade:          crossfade,
+		InstantManualPause: raw.Fade.InstantManualPause,
+		Schedule:           schedule,
+		Calendars:          raw.Calendars,
 		Camera:             raw.Camera,
 		Router:             raw.Router,
 		Telegram:           raw.Telegram,
+		Notifiers:          raw.Notifiers,
+		MQTT:               raw.MQTT,
+		HTTP:               raw.HTTP,
+		StateFile:          stateFile,
+		JournalFile:        journalFile,
+		Loudness:           raw.Loudness.Enabled,
+		LoudnessTarget:     loudnessTarget,
+		LoudnessMaxBoost:   loudnessMaxBoost,
+		LoudnessFile:       loudnessFile,
+		DSP:                raw.DSP,
+		Generators:         raw.Generators,
+		Output:             raw.Output,
 	}, nil
 }
+
+func parseOptionalDuration(value string, fallback time.Duration) (time.Duration, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("negative duration %s", value)
+	}
+	return d, nil
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/faiface/beep"
+)
+
+const (
+	defaultLimiterThreshold = -1.0
+	defaultLimiterRelease   = 200 * time.Millisecond
+)
+
+type DSPConfig struct {
+	Preset  string                     `yaml:"preset"`
+	Presets map[string]DSPPresetConfig `yaml:"presets"`
+}
+
+type DSPPresetConfig struct {
+	Filters []DSPFilterConfig `yaml:"filters"`
+	Limiter *DSPLimiterConfig `yaml:"limiter"`
+}
+
+type DSPFilterConfig struct {
+	Type string  `yaml:"type"`
+	Freq float64 `yaml:"freq"`
+	Q    float64 `yaml:"q"`
+	Gain float64 `yaml:"gain"`
+}
+
+type DSPLimiterConfig struct {
+	Threshold *float64 `yaml:"threshold"`
+	Release   string   `yaml:"release"`
+}
+
+// dspOff is the preset name that bypasses the chain.
+const dspOff = "off"
+
+func validateDSP(cfg DSPConfig) error {
+	for name, preset := range cfg.Presets {
+		if strings.EqualFold(name, dspOff) {
+			return fmt.Errorf("dsp.presets: %q is reserved", name)
+		}
+		if _, err := buildDSPStages(preset, 48000); err != nil {
+			return fmt.Errorf("dsp.presets.%s: %w", name, err)
+		}
+	}
+	if cfg.Preset != "" {
+		if _, ok := cfg.Presets[cfg.Preset]; !ok {
+			return fmt.Errorf("dsp.preset: unknown preset %q", cfg.Preset)
+		}
+	}
+	return nil
+}
+
+func dspPresetNames(presets map[string]DSPPresetConfig) []string {
+	names := make([]string, 0, len(presets))
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+type dspStages struct {
+	filters []*biquad
+	limiter *limiter
+}
+
+func buildDSPStages(preset DSPPresetConfig, rate float64) (dspStages, error) {
+	var stages dspStages
+	for i, f := range preset.Filters {
+		if f.Freq <= 0 || f.Freq > 20000 {
+			return dspStages{}, fmt.Errorf("filters[%d]: freq must be 1-20000 Hz", i)
+		}
+		q := f.Q
+		if q < 0 {
+			return dspStages{}, fmt.Errorf("filters[%d]: q must be positive", i)
+		}
+		var filter *biquad
+		switch strings.ToLower(f.Type) {
+		case "lowpass", "low_pass":
+			filter = lowPass(rate, f.Freq, orDefault(q, math.Sqrt2/2))
+		case "highpass", "high_pass":
+			filter = highPass(rate, f.Freq, orDefault(q, math.Sqrt2/2))
+		case "bandpass", "band_pass":
+			filter = bandPass(rate, f.Freq, orDefault(q, 1))
+		case "peaking", "peak", "eq":
+			filter = peakingEQ(rate, f.Freq, orDefault(q, 1), f.Gain)
+		default:
+			return dspStages{}, fmt.Errorf("filters[%d]: unknown type %q (lowpass, highpass, bandpass or peaking)", i, f.Type)
+		}
+		stages.filters = append(stages.filters, filter)
+	}
+	if preset.Limiter != nil {
+		threshold := defaultLimiterThreshold
+		if preset.Limiter.Threshold != nil {
+			threshold = *preset.Limiter.Threshold
+		}
+		if threshold > 0 {
+			return dspStages{}, fmt.Errorf("limiter: threshold must be 0 dBFS or below")
+		}
+		release, err := parseOptionalDuration(preset.Limiter.Release, defaultLimiterRelease)
+		if err != nil {
+			return dspStages{}, fmt.Errorf("limiter: invalid release: %w", err)
+		}
+		stages.limiter = newLimiter(rate, threshold, release)
+	}
+	return stages, nil
+}
+
+func orDefault(v, fallback float64) float64 {
+	if v == 0 {
+		return fallback
+	}
+	return v
+}
+
+// limiter is a peak limiter with instant attack and exponential release, so
+// the output never exceeds the threshold.
+type limiter struct {
+	threshold float64
+	release   float64
+	gain      float64
+}
+
+func newLimiter(rate, thresholdDB float64, release time.Duration) *limiter {
+	coef := 1.0
+	if samples := release.Seconds() * rate; samples > 0 {
+		coef = 1 - math.Exp(-1/samples)
+	}
+	return &limiter{threshold: math.Pow(10, thresholdDB/20), release: coef, gain: 1}
+}
+
+func (l *limiter) process(s *[2]float64) {
+	target := 1.0
+	if peak := max(math.Abs(s[0]), math.Abs(s[1])); peak > l.threshold {
+		target = l.threshold / peak
+	}
+	if target < l.gain {
+		l.gain = target
+	} else {
+		l.gain += (target - l.gain) * l.release
+	}
+	s[0] *= l.gain
+	s[1] *= l.gain
+}
+
+// dspChain runs the filters and the limiter of the active preset on the
+// resampled output. The stages are swapped under the speaker lock.
+type dspChain struct {
+	Streamer beep.Streamer
+	stages   dspStages
+}
+
+func (d *dspChain) Stream(samples [][2]float64) (int, bool) {
+	n, ok := d.Streamer.Stream(samples)
+	if len(d.stages.filters) == 0 && d.stages.limiter == nil {
+		return n, ok
+	}
+	for i := range samples[:n] {
+		for _, f := range d.stages.filters {
+			samples[i][0] = f.process(samples[i][0], 0)
+			samples[i][1] = f.process(samples[i][1], 1)
+		}
+		if d.stages.limiter != nil {
+			d.stages.limiter.process(&samples[i])
+		}
+	}
+	return n, ok
+}
+
+func (d *dspChain) Err() error {
+	return d.Streamer.Err()
+}
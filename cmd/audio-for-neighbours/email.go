@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type emailNotifier struct {
+	host     string
+	port     int
+	username string
+	password string
+	from     string
+	to       []string
+	tls      bool
+	timeout  time.Duration
+}
+
+func newEmailNotifier(cfg NotifierConfig) (*emailNotifier, error) {
+	if cfg.Host == "" || cfg.From == "" || len(cfg.To) == 0 {
+		return nil, fmt.Errorf("email notifier needs host, from and to")
+	}
+	port := cfg.Port
+	if port == 0 {
+		port = 587
+		if cfg.TLS {
+			port = 465
+		}
+	}
+	return &emailNotifier{
+		host:     cfg.Host,
+		port:     port,
+		username: cfg.Username,
+		password: cfg.Password,
+		from:     cfg.From,
+		to:       cfg.To,
+		tls:      cfg.TLS,
+		timeout:  notifierTimeout,
+	}, nil
+}
+
+func (e *emailNotifier) Name() string {
+	return "email"
+}
+
+func (e *emailNotifier) SendText(kind, text string) error {
+	return e.send(kind, text, "", "", nil)
+}
+
+func (e *emailNotifier) SendPhoto(kind, filename string, data []byte) error {
+	return e.send(kind, "Snapshot attached.", filename, "image/jpeg", data)
+}
+
+func (e *emailNotifier) SendVideo(kind, filename string, data []byte) error {
+	return e.send(kind, "Video attached.", filename, "video/mp4", data)
+}
+
+func (e *emailNotifier) send(kind, text, filename, contentType string, data []byte) error {
+	msg := buildEmailMessage(e.from, e.to, "audio-for-neighbours: "+kind, text, filename, contentType, data)
+	addr := net.JoinHostPort(e.host, strconv.Itoa(e.port))
+
+	var auth smtp.Auth
+	if e.username != "" {
+		auth = smtp.PlainAuth("", e.username, e.password, e.host)
+	}
+
+	// smtp.SendMail has no timeouts, so dial ourselves and bound the whole
+	// conversation with a deadline.
+	dialer := &net.Dialer{Timeout: e.timeout}
+	var conn net.Conn
+	var err error
+	if e.tls {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{ServerName: e.host})
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	if err := conn.SetDeadline(time.Now().Add(e.timeout)); err != nil {
+		conn.Close()
+		return err
+	}
+	client, err := smtp.NewClient(conn, e.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+	if !e.tls {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(&tls.Config{ServerName: e.host}); err != nil {
+				return err
+			}
+		}
+	}
+	if auth != nil {
+		if err := client.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(e.from); err != nil {
+		return err
+	}
+	for _, to := range e.to {
+		if err := client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+func buildEmailMessage(from string, to []string, subject, text, filename, contentType string, data []byte) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+
+	if data == nil {
+		b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+		b.WriteString(strings.ReplaceAll(text, "\n", "\r\n"))
+		b.WriteString("\r\n")
+		return b.Bytes()
+	}
+
+	boundary := newMIMEBoundary()
+	fmt.Fprintf(&b, "Content-Type: multipart/mixed; boundary=%q\r\n\r\n", boundary)
+	fmt.Fprintf(&b, "--%s\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n%s\r\n", boundary, text)
+	fmt.Fprintf(&b, "--%s\r\nContent-Type: %s\r\nContent-Transfer-Encoding: base64\r\n", boundary, contentType)
+	fmt.Fprintf(&b, "Content-Disposition: attachment; filename=%q\r\n\r\n", filename)
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 76 {
+		b.WriteString(encoded[:76])
+		b.WriteString("\r\n")
+		encoded = encoded[76:]
+	}
+	b.WriteString(encoded)
+	fmt.Fprintf(&b, "\r\n--%s--\r\n", boundary)
+	return b.Bytes()
+}
+
+func newMIMEBoundary() string {
+	var buf [12]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return "audio-for-neighbours-boundary"
+	}
+	return hex.EncodeToString(buf[:])
+}
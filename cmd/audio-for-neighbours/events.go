@@ -0,0 +1,96 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+type appEvent struct {
+	ID      uint64    `json:"id"`
+	Time    time.Time `json:"time"`
+	Type    string    `json:"type"`
+	Action  string    `json:"action"`
+	Name    string    `json:"name,omitempty"`
+	Trigger string    `json:"trigger,omitempty"`
+	Reasons []string  `json:"reasons,omitempty"`
+}
+
+type eventBus struct {
+	mu          sync.Mutex
+	nextID      uint64
+	recent      []appEvent
+	limit       int
+	subscribers map[chan appEvent]struct{}
+	sink        func(appEvent)
+}
+
+func newEventBus(limit int) *eventBus {
+	return &eventBus{
+		// IDs continue from the start time, so a client reconnecting after
+		// a restart with an old Last-Event-ID still gets the new events.
+		nextID:      uint64(time.Now().UnixMicro()),
+		limit:       limit,
+		subscribers: make(map[chan appEvent]struct{}),
+	}
+}
+
+func (b *eventBus) setSink(sink func(appEvent)) {
+	b.mu.Lock()
+	b.sink = sink
+	b.mu.Unlock()
+}
+
+func (b *eventBus) publish(evt appEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.nextID++
+	evt.ID = b.nextID
+	if evt.Time.IsZero() {
+		evt.Time = time.Now()
+	}
+	if b.sink != nil {
+		b.sink(evt)
+	}
+	b.recent = append(b.recent, evt)
+	if len(b.recent) > b.limit {
+		b.recent = b.recent[len(b.recent)-b.limit:]
+	}
+	for ch := range b.subscribers {
+		select {
+		case ch <- evt:
+		default:
+		}
+	}
+}
+
+func (b *eventBus) subscribe() (<-chan appEvent, func()) {
+	ch := make(chan appEvent, 64)
+	b.mu.Lock()
+	b.subscribers[ch] = struct{}{}
+	b.mu.Unlock()
+
+	return ch, func() {
+		b.mu.Lock()
+		delete(b.subscribers, ch)
+		b.mu.Unlock()
+	}
+}
+
+func (b *eventBus) since(id uint64) []appEvent {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var out []appEvent
+	for _, evt := range b.recent {
+		if evt.ID > id {
+			out = append(out, evt)
+		}
+	}
+	return out
+}
+
+func (b *eventBus) lastID() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.nextID
+}
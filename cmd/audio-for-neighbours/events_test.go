@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEventIDsIncreaseAcrossRestarts(t *testing.T) {
+	before := newEventBus(10)
+	before.publish(appEvent{Type: eventState, Action: "pause"})
+	before.publish(appEvent{Type: eventState, Action: "resume"})
+	time.Sleep(time.Millisecond)
+
+	after := newEventBus(10)
+	after.publish(appEvent{Type: eventState, Action: "pause"})
+	if got := after.since(before.lastID()); len(got) != 1 {
+		t.Fatalf("events after the old last ID: %d, want 1", len(got))
+	}
+}
+
+// readSSEIDs returns the IDs of the first n events on the stream.
+func readSSEIDs(t *testing.T, srv *httptest.Server, lastID string, n int) []uint64 {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	req.Header.Set("Last-Event-ID", lastID)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var ids []uint64
+	scanner := bufio.NewScanner(resp.Body)
+	for len(ids) < n && scanner.Scan() {
+		if value, ok := strings.CutPrefix(scanner.Text(), "id: "); ok {
+			id, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) < n {
+		t.Fatalf("got %d events, want %d", len(ids), n)
+	}
+	return ids
+}
+
+func TestEventStreamReplay(t *testing.T) {
+	a := &app{events: newEventBus(10)}
+	h := &httpAPI{app: a, done: make(chan struct{})}
+	srv := httptest.NewServer(http.HandlerFunc(h.handleEvents))
+	defer srv.Close()
+	defer close(h.done)
+
+	a.events.publish(appEvent{Type: eventState, Action: "pause"})
+	a.events.publish(appEvent{Type: eventState, Action: "resume"})
+	first := a.events.since(0)[0].ID
+
+	if ids := readSSEIDs(t, srv, strconv.FormatUint(first, 10), 1); ids[0] != first+1 {
+		t.Errorf("replayed %v, want %d", ids, first+1)
+	}
+	// An ID from before a restart with the clock set back.
+	future := strconv.FormatUint(a.events.lastID()+1000, 10)
+	if ids := readSSEIDs(t, srv, future, 2); ids[0] != first || ids[1] != first+1 {
+		t.Errorf("replayed %v, want %d and %d", ids, first, first+1)
+	}
+}
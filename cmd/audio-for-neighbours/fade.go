@@ -0,0 +1,68 @@
+package main
+
+import "github.com/faiface/beep"
+
+// fader replaces beep.Ctrl for pausing: it ramps the gain down before
+// pausing and back up on resume. Once faded out it stops pulling samples
+// from the wrapped streamer, so the position is kept while paused.
+type fader struct {
+	Streamer   beep.Streamer
+	inSamples  int
+	outSamples int
+	gain       float64
+	target     float64
+	step       float64
+}
+
+func newFader(s beep.Streamer, paused bool, inSamples, outSamples int) *fader {
+	gain := 1.0
+	if paused {
+		gain = 0
+	}
+	return &fader{
+		Streamer:   s,
+		inSamples:  inSamples,
+		outSamples: outSamples,
+		gain:       gain,
+		target:     gain,
+	}
+}
+
+func (f *fader) setPaused(paused, instant bool) {
+	target, samples := 1.0, f.inSamples
+	if paused {
+		target, samples = 0, f.outSamples
+	}
+	f.target = target
+	if instant || samples <= 0 {
+		f.gain = target
+		return
+	}
+	f.step = 1 / float64(samples)
+}
+
+func (f *fader) Stream(samples [][2]float64) (int, bool) {
+	if f.gain == 0 && f.target == 0 {
+		clear(samples)
+		return len(samples), true
+	}
+	n, ok := f.Streamer.Stream(samples)
+	if f.gain == 1 && f.target == 1 {
+		return n, ok
+	}
+	for i := 0; i < n; i++ {
+		switch {
+		case f.gain < f.target:
+			f.gain = min(f.target, f.gain+f.step)
+		case f.gain > f.target:
+			f.gain = max(f.target, f.gain-f.step)
+		}
+		samples[i][0] *= f.gain
+		samples[i][1] *= f.gain
+	}
+	return n, ok
+}
+
+func (f *fader) Err() error {
+	return f.Streamer.Err()
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/faiface/beep"
+	"github.com/faiface/beep/flac"
+	"github.com/faiface/beep/mp3"
+	"github.com/faiface/beep/vorbis"
+	"github.com/faiface/beep/wav"
+)
+
+type audioFormat string
+
+const (
+	formatUnknown audioFormat = ""
+	formatMP3     audioFormat = "mp3"
+	formatWAV     audioFormat = "wav"
+	formatFLAC    audioFormat = "flac"
+	formatVorbis  audioFormat = "vorbis"
+	formatOpus    audioFormat = "opus"
+)
+
+const sniffLen = 512
+
+// fileSettleTime is how long a file must stay unmodified before it is
+// played, so files that are still being copied are left alone.
+const fileSettleTime = 5 * time.Second
+
+// sniffAudio identifies the container from the first bytes of a file. The
+// extension is only used as a hint for MP3 files without an ID3 tag whose
+// first frame does not start at offset 0.
+func sniffAudio(header []byte, name string) audioFormat {
+	switch {
+	case bytes.HasPrefix(header, []byte("fLaC")):
+		return formatFLAC
+	case len(header) >= 12 && bytes.Equal(header[0:4], []byte("RIFF")) && bytes.Equal(header[8:12], []byte("WAVE")):
+		return formatWAV
+	case bytes.HasPrefix(header, []byte("OggS")):
+		return sniffOgg(header)
+	case bytes.HasPrefix(header, []byte("ID3")):
+		return formatMP3
+	// A frame sync with layer bits of zero is AAC ADTS, not MPEG audio.
+	case len(header) >= 2 && header[0] == 0xFF && header[1]&0xE0 == 0xE0 && header[1]&0x06 != 0:
+		return formatMP3
+	case strings.EqualFold(filepath.Ext(name), ".mp3") && bytes.Contains(header, []byte{0xFF, 0xFB}):
+		return formatMP3
+	}
+	return formatUnknown
+}
+
+func sniffOgg(header []byte) audioFormat {
+	if len(header) < 27 || len(header) < 27+int(header[26]) {
+		return formatUnknown
+	}
+	packet := header[27+int(header[26]):]
+	switch {
+	case bytes.HasPrefix(packet, []byte("\x01vorbis")):
+		return formatVorbis
+	case bytes.HasPrefix(packet, []byte("OpusHead")):
+		return formatOpus
+	}
+	return formatUnknown
+}
+
+func readHeader(r io.ReadSeeker) ([]byte, error) {
+	header := make([]byte, sniffLen)
+	n, err := io.ReadFull(r, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return header[:n], nil
+}
+
+type nopReadSeekCloser struct {
+	io.ReadSeeker
+}
+
+func (nopReadSeekCloser) Close() error {
+	return nil
+}
+
+func decodeAudio(r io.ReadSeeker, path string) (beep.StreamSeekCloser, beep.Format, error) {
+	header, err := readHeader(r)
+	if err != nil {
+		return nil, beep.Format{}, err
+	}
+	rc := nopReadSeekCloser{r}
+	switch format := sniffAudio(header, path); format {
+	case formatMP3:
+		return mp3.Decode(rc)
+	case formatWAV:
+		return wav.Decode(rc)
+	case formatFLAC:
+		return flac.Decode(rc)
+	case formatVorbis:
+		return vorbis.Decode(rc)
+	case formatOpus:
+		return nil, beep.Format{}, fmt.Errorf("ogg opus is not supported: %s", filepath.Base(path))
+	default:
+		return nil, beep.Format{}, fmt.Errorf("unsupported audio format: %s", filepath.Base(path))
+	}
+}
+
+func sniffFile(path string) (audioFormat, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return formatUnknown, err
+	}
+	defer f.Close()
+	header, err := readHeader(f)
+	if err != nil {
+		return formatUnknown, err
+	}
+	return sniffAudio(header, path), nil
+}
+
+type sniffCacheEntry struct {
+	size    int64
+	modTime int64
+	format  audioFormat
+}
+
+var (
+	sniffMu     sync.Mutex
+	sniffCache  = make(map[string]sniffCacheEntry)
+	lastSkipped string
+)
+
+// scanAudioFiles returns the playable files in dir by name and logs the
+// skipped ones whenever that list changes. Files modified within the last
+// few seconds are left out until they are complete.
+func scanAudioFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files, skipped []string
+	seen := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasPrefix(name, ".") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || !info.Mode().IsRegular() || time.Since(info.ModTime()) < fileSettleTime {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		seen[path] = true
+
+		sniffMu.Lock()
+		cached, ok := sniffCache[path]
+		sniffMu.Unlock()
+		format := cached.format
+		if !ok || cached.size != info.Size() || cached.modTime != info.ModTime().UnixNano() {
+			format, err = sniffFile(path)
+			if err != nil {
+				skipped = append(skipped, fmt.Sprintf("%s (%v)", name, err))
+				continue
+			}
+			sniffMu.Lock()
+			sniffCache[path] = sniffCacheEntry{size: info.Size(), modTime: info.ModTime().UnixNano(), format: format}
+			sniffMu.Unlock()
+		}
+
+		switch format {
+		case formatUnknown:
+			skipped = append(skipped, name+" (unknown format)")
+		case formatOpus:
+			skipped = append(skipped, name+" (ogg opus not supported)")
+		default:
+			files = append(files, path)
+		}
+	}
+	sort.Strings(files)
+
+	sniffMu.Lock()
+	for path := range sniffCache {
+		if filepath.Dir(path) == filepath.Clean(dir) && !seen[path] {
+			delete(sniffCache, path)
+		}
+	}
+	summary := strings.Join(skipped, ", ")
+	changed := summary != lastSkipped
+	lastSkipped = summary
+	sniffMu.Unlock()
+
+	if changed && len(skipped) > 0 {
+		log.Printf("audio: skipped %d file(s) in %s: %s", len(skipped), dir, summary)
+	}
+	return files, nil
+}
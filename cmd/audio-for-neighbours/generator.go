@@ -0,0 +1,283 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	"github.com/faiface/beep"
+)
+
+// generatorPrefix marks pseudo-files that are synthesized instead of
+// decoded, e.g. "gen:thump" in the library list or a playlist.
+const generatorPrefix = "gen:"
+
+const (
+	defaultGeneratorLevel    = -12.0
+	defaultGeneratorDuration = time.Minute
+	defaultGeneratorRate     = beep.SampleRate(44100)
+	defaultPulseFreq         = 50.0
+	defaultPulseLength       = 80 * time.Millisecond
+)
+
+type GeneratorConfig struct {
+	Name     string   `yaml:"name"`
+	Type     string   `yaml:"type"`
+	Freq     float64  `yaml:"freq"`
+	To       float64  `yaml:"to"`
+	Color    string   `yaml:"color"`
+	Level    *float64 `yaml:"level"`
+	Duration string   `yaml:"duration"`
+	Interval string   `yaml:"interval"`
+	Length   string   `yaml:"length"`
+	Pattern  string   `yaml:"pattern"`
+}
+
+func isGenerator(path string) bool {
+	return strings.HasPrefix(path, generatorPrefix)
+}
+
+func generatorPaths(cfgs []GeneratorConfig) []string {
+	paths := make([]string, len(cfgs))
+	for i, cfg := range cfgs {
+		paths[i] = generatorPrefix + cfg.Name
+	}
+	return paths
+}
+
+func validateGenerators(cfgs []GeneratorConfig) error {
+	seen := make(map[string]bool, len(cfgs))
+	for i, cfg := range cfgs {
+		if cfg.Name == "" || strings.ContainsAny(cfg.Name, `/\`) {
+			return fmt.Errorf("generators[%d]: name must be set and must not contain slashes", i)
+		}
+		if seen[cfg.Name] {
+			return fmt.Errorf("generators[%d]: duplicate name %q", i, cfg.Name)
+		}
+		seen[cfg.Name] = true
+		if _, err := newGenerator(cfg, defaultGeneratorRate); err != nil {
+			return fmt.Errorf("generators[%d] (%s): %w", i, cfg.Name, err)
+		}
+	}
+	return nil
+}
+
+// openGenerator looks up a pseudo-file by path and starts it at the given
+// sample rate, or at a default rate before the output is running.
+func openGenerator(path string, rate beep.SampleRate) (beep.StreamSeekCloser, beep.Format, error) {
+	if rate == 0 {
+		rate = defaultGeneratorRate
+	}
+	name := strings.TrimPrefix(path, generatorPrefix)
+	for _, cfg := range appConfig.Generators {
+		if cfg.Name != name {
+			continue
+		}
+		g, err := newGenerator(cfg, rate)
+		if err != nil {
+			return nil, beep.Format{}, err
+		}
+		return g, beep.Format{SampleRate: rate, NumChannels: 2, Precision: 2}, nil
+	}
+	return nil, beep.Format{}, fmt.Errorf("unknown generator %q", name)
+}
+
+// generator renders one mono signal to both channels. The signal is a
+// function of the sample position, so seeking works like in a file; noise
+// only keeps its filter state.
+type generator struct {
+	length int
+	pos    int
+	level  float64
+	sample func(i int) float64
+}
+
+func newGenerator(cfg GeneratorConfig, sampleRate beep.SampleRate) (*generator, error) {
+	rate := float64(sampleRate)
+	duration, err := parseOptionalDuration(cfg.Duration, defaultGeneratorDuration)
+	if err != nil || duration <= 0 {
+		return nil, fmt.Errorf("invalid duration %q", cfg.Duration)
+	}
+	level := defaultGeneratorLevel
+	if cfg.Level != nil {
+		level = *cfg.Level
+	}
+	if level > 0 {
+		return nil, fmt.Errorf("level must be 0 dBFS or below")
+	}
+	g := &generator{
+		length: sampleRate.N(duration),
+		level:  math.Pow(10, level/20),
+	}
+	nyquist := rate / 2
+
+	switch strings.ToLower(cfg.Type) {
+	case "sine", "square":
+		if cfg.Freq <= 0 || cfg.Freq >= nyquist {
+			return nil, fmt.Errorf("freq must be between 0 and %.0f Hz", nyquist)
+		}
+		square := strings.EqualFold(cfg.Type, "square")
+		g.sample = func(i int) float64 {
+			v := math.Sin(2 * math.Pi * cfg.Freq * float64(i) / rate)
+			if square {
+				return math.Copysign(1, v)
+			}
+			return v
+		}
+	case "sweep":
+		if cfg.Freq <= 0 || cfg.To <= 0 || cfg.Freq >= nyquist || cfg.To >= nyquist {
+			return nil, fmt.Errorf("freq and to must be between 0 and %.0f Hz", nyquist)
+		}
+		g.sample = sweep(cfg.Freq, cfg.To, duration.Seconds(), rate)
+	case "noise":
+		switch strings.ToLower(cfg.Color) {
+		case "", "white":
+			g.sample = func(int) float64 { return rand.Float64()*2 - 1 }
+		case "pink":
+			g.sample = pinkNoise()
+		case "brown", "brownian", "red":
+			g.sample = brownNoise()
+		default:
+			return nil, fmt.Errorf("unknown noise color %q (white, pink or brown)", cfg.Color)
+		}
+	case "pulse":
+		sample, err := pulse(cfg, rate)
+		if err != nil {
+			return nil, err
+		}
+		g.sample = sample
+	default:
+		return nil, fmt.Errorf("unknown type %q (sine, square, sweep, noise or pulse)", cfg.Type)
+	}
+	return g, nil
+}
+
+// sweep glides exponentially from one frequency to another over the
+// duration, so every octave takes the same time.
+func sweep(from, to, seconds, rate float64) func(int) float64 {
+	if from == to {
+		return func(i int) float64 { return math.Sin(2 * math.Pi * from * float64(i) / rate) }
+	}
+	k := math.Log(to / from)
+	return func(i int) float64 {
+		t := float64(i) / rate
+		return math.Sin(2 * math.Pi * from * seconds / k * (math.Exp(k*t/seconds) - 1))
+	}
+}
+
+// pinkNoise filters white noise to -3 dB per octave (Paul Kellet's
+// refined method).
+func pinkNoise() func(int) float64 {
+	var b [7]float64
+	return func(int) float64 {
+		white := rand.Float64()*2 - 1
+		b[0] = 0.99886*b[0] + white*0.0555179
+		b[1] = 0.99332*b[1] + white*0.0750759
+		b[2] = 0.96900*b[2] + white*0.1538520
+		b[3] = 0.86650*b[3] + white*0.3104856
+		b[4] = 0.55000*b[4] + white*0.5329522
+		b[5] = -0.7616*b[5] - white*0.0168980
+		out := b[0] + b[1] + b[2] + b[3] + b[4] + b[5] + b[6] + white*0.5362
+		b[6] = white * 0.115926
+		return out * 0.11
+	}
+}
+
+// brownNoise integrates white noise with a small leak so it stays
+// centred.
+func brownNoise() func(int) float64 {
+	last := 0.0
+	return func(int) float64 {
+		last = (last + 0.02*(rand.Float64()*2-1)) / 1.02
+		return last * 3.5
+	}
+}
+
+// pulse plays a decaying tone burst on every step of the pattern: 'X' is
+// a full pulse, 'x' a pulse at half amplitude and '.' or '-' a rest. Each
+// step lasts one interval.
+func pulse(cfg GeneratorConfig, rate float64) (func(int) float64, error) {
+	interval, err := parseOptionalDuration(cfg.Interval, 0)
+	if err != nil || interval <= 0 {
+		return nil, fmt.Errorf("pulse needs an interval, e.g. \"500ms\"")
+	}
+	length, err := parseOptionalDuration(cfg.Length, defaultPulseLength)
+	if err != nil || length <= 0 {
+		return nil, fmt.Errorf("invalid length %q", cfg.Length)
+	}
+	freq := cfg.Freq
+	if freq == 0 {
+		freq = defaultPulseFreq
+	}
+	if freq < 0 || freq >= rate/2 {
+		return nil, fmt.Errorf("freq must be between 0 and %.0f Hz", rate/2)
+	}
+	pattern := cfg.Pattern
+	if pattern == "" {
+		pattern = "X"
+	}
+	steps := make([]float64, 0, len(pattern))
+	for _, c := range pattern {
+		switch c {
+		case 'X':
+			steps = append(steps, 1)
+		case 'x':
+			steps = append(steps, 0.5)
+		case '.', '-':
+			steps = append(steps, 0)
+		case ' ':
+		default:
+			return nil, fmt.Errorf("invalid pattern character %q (X, x, . or -)", c)
+		}
+	}
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("empty pattern")
+	}
+
+	stepLen := max(1, int(interval.Seconds()*rate))
+	pulseLen := min(stepLen, max(1, int(length.Seconds()*rate)))
+	attack := max(1.0, 0.002*rate)
+	return func(i int) float64 {
+		amp := steps[(i/stepLen)%len(steps)]
+		pos := i % stepLen
+		if amp == 0 || pos >= pulseLen {
+			return 0
+		}
+		env := min(1, float64(pos)/attack) * math.Exp(-5*float64(pos)/float64(pulseLen))
+		return amp * env * math.Sin(2*math.Pi*freq*float64(pos)/rate)
+	}, nil
+}
+
+func (g *generator) Stream(samples [][2]float64) (int, bool) {
+	n := 0
+	for n < len(samples) && g.pos < g.length {
+		v := g.sample(g.pos) * g.level
+		samples[n] = [2]float64{v, v}
+		g.pos++
+		n++
+	}
+	return n, n > 0
+}
+
+func (g *generator) Err() error {
+	return nil
+}
+
+func (g *generator) Len() int {
+	return g.length
+}
+
+func (g *generator) Position() int {
+	return g.pos
+}
+
+func (g *generator) Seek(p int) error {
+	g.pos = max(0, min(p, g.length))
+	return nil
+}
+
+func (g *generator) Close() error {
+	return nil
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+type HTTPConfig struct {
+	Listen string `yaml:"listen"`
+	Token  string `yaml:"token"`
+}
+
+type httpAPI struct {
+	app    *app
+	token  string
+	server *http.Server
+	done   chan struct{}
+}
+
+func newHTTPAPI(cfg HTTPConfig, a *app) *httpAPI {
+	if cfg.Listen == "" {
+		return nil
+	}
+	if cfg.Token == "" {
+		log.Printf("http api disabled: http.token is empty")
+		return nil
+	}
+
+	h := &httpAPI{app: a, token: cfg.Token, done: make(chan struct{})}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /status", h.auth(h.handleStatus))
+	for _, cmd := range []string{"play", "pause", "auto", "skip"} {
+		mux.HandleFunc("POST /"+cmd, h.auth(h.handleCommand(cmd)))
+	}
+	mux.HandleFunc("GET /snapshot", h.auth(h.handleSnapshot))
+	mux.HandleFunc("GET /events", h.auth(h.handleEvents))
+	mux.HandleFunc("GET /events/recent", h.auth(h.handleRecentEvents))
+	mux.HandleFunc("POST /volume", h.auth(h.handleVolume))
+	mux.HandleFunc("GET /library", h.auth(h.handleLibrary))
+	mux.HandleFunc("PUT /library/order", h.auth(h.handleLibraryOrder))
+	mux.Handle("GET /metrics", h.auth(promhttp.Handler().ServeHTTP))
+	mux.Handle("GET /", dashboardHandler())
+
+	h.server = &http.Server{
+		Addr:              cfg.Listen,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return h
+}
+
+func (h *httpAPI) run(ctx context.Context) {
+	go func() {
+		<-ctx.Done()
+		close(h.done)
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = h.server.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("http api listening on %s", h.server.Addr)
+	if err := h.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Printf("http api error: %v", err)
+	}
+}
+
+func (h *httpAPI) auth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if token == "" {
+			token = r.URL.Query().Get("token")
+		}
+		if subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) != 1 {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (h *httpAPI) handleStatus(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.app.status())
+}
+
+func (h *httpAPI) handleCommand(cmd string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		args := r.URL.Query().Get("for")
+		if until := r.URL.Query().Get("until"); until != "" {
+			args = "until " + until
+		}
+		if _, err := parseOverrideUntil(args, time.Now(), h.app.schedule.location()); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		resp := h.app.handleCommand(commandRequest{
+			name:   cmd,
+			args:   args,
+			source: "http",
+			role:   roleAdmin,
+		})
+		writeJSON(w, http.StatusOK, map[string]any{
+			"message": resp,
+			"status":  h.app.status(),
+		})
+	}
+}
+
+func (h *httpAPI) handleVolume(w http.ResponseWriter, r *http.Request) {
+	level, err := strconv.Atoi(r.URL.Query().Get("level"))
+	if err != nil || level < 0 || level > 100 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "level must be 0-100"})
+		return
+	}
+	h.app.setVolume(level)
+	writeJSON(w, http.StatusOK, h.app.status())
+}
+
+func (h *httpAPI) handleLibrary(w http.ResponseWriter, r *http.Request) {
+	files, err := listAudioFiles(appConfig.AudioDir)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	names := make([]string, 0, len(files))
+	for _, file := range files {
+		names = append(names, filepath.Base(file))
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"files": names})
+}
+
+func (h *httpAPI) handleLibraryOrder(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Files []string `json:"files"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	if err := writeLibraryOrder(appConfig.AudioDir, req.Files); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	log.Printf("library order updated via http (%d files)", len(req.Files))
+	h.handleLibrary(w, r)
+}
+
+func (h *httpAPI) handleRecentEvents(w http.ResponseWriter, r *http.Request) {
+	events := h.app.events.since(0)
+	if events == nil {
+		events = []appEvent{}
+	}
+	writeJSON(w, http.StatusOK, events)
+}
+
+func (h *httpAPI) handleSnapshot(w http.ResponseWriter, r *http.Request) {
+	if h.app.snapshot == nil {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "snapshot not available"})
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+	image, err := h.app.snapshot.getSnapshot(ctx)
+	if err != nil {
+		writeJSON(w, http.StatusBadGateway, map[string]string{"error": err.Error()})
+		return
+	}
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Cache-Control", "no-store")
+	_, _ = w.Write(image)
+}
+
+func (h *httpAPI) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "streaming not supported"})
+		return
+	}
+
+	events, cancel := h.app.events.subscribe()
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	var lastID uint64
+	if id, err := strconv.ParseUint(r.Header.Get("Last-Event-ID"), 10, 64); err == nil {
+		// An ID from the future was handed out before a restart with the
+		// clock set back; everything buffered since is new to the client.
+		if id > h.app.events.lastID() {
+			id = 0
+		}
+		lastID = id
+		for _, evt := range h.app.events.since(id) {
+			writeSSE(w, evt)
+			lastID = evt.ID
+		}
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(25 * time.Second)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-h.done:
+			return
+		case <-keepAlive.C:
+			_, _ = fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		case evt := <-events:
+			if evt.ID <= lastID {
+				continue
+			}
+			writeSSE(w, evt)
+			lastID = evt.ID
+			flusher.Flush()
+		}
+	}
+}
+
+func writeSSE(w http.ResponseWriter, evt appEvent) {
+	data, err := json.Marshal(evt)
+	if err != nil {
+		return
+	}
+	_, _ = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", evt.ID, evt.Type, data)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultJournalFile = "journal.jsonl"
+	eventService       = "service"
+)
+
+// journalQueueSize is how many events may wait for a slow disk.
+const journalQueueSize = 256
+
+type journal struct {
+	path  string
+	mu    sync.Mutex
+	queue chan []byte
+	// flushed answers a nil entry in queue once everything before it is
+	// written.
+	flushed chan struct{}
+}
+
+func newJournal(path string) *journal {
+	j := &journal{
+		path:    path,
+		queue:   make(chan []byte, journalQueueSize),
+		flushed: make(chan struct{}),
+	}
+	go j.run()
+	return j
+}
+
+// append queues the event for the writer. It is called with the event bus
+// locked, so it must not touch the disk itself.
+func (j *journal) append(evt appEvent) {
+	if j == nil {
+		return
+	}
+	data, err := json.Marshal(evt)
+	if err != nil {
+		return
+	}
+	data = append(data, '\n')
+	select {
+	case j.queue <- data:
+	default:
+		log.Printf("journal: queue full, dropping %s %s event", evt.Type, evt.Action)
+	}
+}
+
+func (j *journal) run() {
+	for data := range j.queue {
+		if data == nil {
+			j.flushed <- struct{}{}
+			continue
+		}
+		j.write(data)
+	}
+}
+
+// flush waits until the events queued so far are written.
+func (j *journal) flush() {
+	if j == nil {
+		return
+	}
+	j.queue <- nil
+	<-j.flushed
+}
+
+func (j *journal) write(data []byte) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	f, err := os.OpenFile(j.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		log.Printf("journal write error: %v", err)
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(data); err != nil {
+		log.Printf("journal write error: %v", err)
+	}
+}
+
+func (j *journal) read() ([]appEvent, error) {
+	j.flush()
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	f, err := os.Open(j.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var events []appEvent
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for scanner.Scan() {
+		var evt appEvent
+		if err := json.Unmarshal(scanner.Bytes(), &evt); err != nil {
+			// A crash can leave a truncated last line behind.
+			continue
+		}
+		events = append(events, evt)
+	}
+	return events, scanner.Err()
+}
+
+func (j *journal) history(n int, loc *time.Location) (string, error) {
+	events, err := j.read()
+	if err != nil {
+		return "", err
+	}
+	if len(events) == 0 {
+		return "Journal is empty.", nil
+	}
+	if len(events) > n {
+		events = events[len(events)-n:]
+	}
+	now := time.Now().In(loc)
+	lines := make([]string, 0, len(events)+1)
+	lines = append(lines, fmt.Sprintf("Last %d events:", len(events)))
+	for _, evt := range events {
+		at := evt.Time.In(loc)
+		stamp := at.Format("15:04:05")
+		if !sameDay(at, now) {
+			stamp = at.Format("Jan 2 15:04")
+		}
+		lines = append(lines, stamp+" "+describeEvent(evt))
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+func describeEvent(evt appEvent) string {
+	text := evt.Type + " " + evt.Action
+	if evt.Name != "" {
+		text += ": " + evt.Name
+	}
+	if evt.Trigger != "" {
+		text += " (" + evt.Trigger + ")"
+	}
+	if len(evt.Reasons) > 0 && evt.Action != "resume" {
+		text += " - " + strings.Join(evt.Reasons, ", ")
+	}
+	return text
+}
+
+type dayStats struct {
+	day     time.Time
+	span    time.Duration
+	covered time.Duration
+	playing time.Duration
+	paused  time.Duration
+	reasons map[string]time.Duration
+	motion  int
+	files   int
+}
+
+func (j *journal) stats(day, now time.Time) (dayStats, error) {
+	events, err := j.read()
+	if err != nil {
+		return dayStats{}, err
+	}
+	return computeDayStats(events, day, now), nil
+}
+
+func computeDayStats(events []appEvent, day, now time.Time) dayStats {
+	start := startOfDay(day)
+	end := start.AddDate(0, 0, 1)
+	if now.Before(end) {
+		end = now
+	}
+	stats := dayStats{day: start, reasons: make(map[string]time.Duration)}
+	if end.After(start) {
+		stats.span = end.Sub(start)
+	}
+
+	var (
+		known  bool
+		paused bool
+		causes []string
+		last   time.Time
+	)
+	account := func(until time.Time) {
+		from := last
+		if from.Before(start) {
+			from = start
+		}
+		if until.After(end) {
+			until = end
+		}
+		if !known || !until.After(from) {
+			return
+		}
+		d := until.Sub(from)
+		stats.covered += d
+		if !paused {
+			stats.playing += d
+			return
+		}
+		stats.paused += d
+		for _, cause := range causes {
+			stats.reasons[cause] += d
+		}
+	}
+
+	for _, evt := range events {
+		if !evt.Time.Before(end) {
+			break
+		}
+		account(evt.Time)
+		last = evt.Time
+
+		switch evt.Type {
+		case eventService:
+			known = evt.Action == "start"
+			paused = false
+			causes = nil
+		case eventState:
+			known = true
+			paused = evt.Action != "resume"
+			causes = pauseCauses(evt.Reasons)
+		}
+		if evt.Time.Before(start) || evt.Action != "start" {
+			continue
+		}
+		switch evt.Type {
+		case eventMotion:
+			stats.motion++
+		case eventFile:
+			stats.files++
+		}
+	}
+	account(end)
+	return stats
+}
+
+func pauseCauses(reasons []string) []string {
+	var causes []string
+	for _, reason := range reasons {
+		var cause string
+		switch {
+		case reason == "none", reason == "forced play":
+			continue
+		case reason == "manual":
+			cause = "manual"
+		case reason == "motion":
+			cause = "motion"
+		case strings.HasPrefix(reason, "presence"):
+			cause = "presence"
+		default:
+			cause = "schedule"
+		}
+		if !containsString(causes, cause) {
+			causes = append(causes, cause)
+		}
+	}
+	return causes
+}
+
+func (s dayStats) String() string {
+	lines := []string{
+		fmt.Sprintf("Stats for %s:", s.day.Format("Mon 2006-01-02")),
+		"Playing: " + formatHoursMinutes(s.playing),
+		"Paused: " + formatHoursMinutes(s.paused),
+	}
+	for _, cause := range pauseMetricReasons {
+		lines = append(lines, fmt.Sprintf("  %s: %s", cause, formatHoursMinutes(s.reasons[cause])))
+	}
+	lines = append(lines,
+		fmt.Sprintf("Motion events: %d", s.motion),
+		fmt.Sprintf("Files played: %d", s.files),
+	)
+	if gap := s.span - s.covered; gap >= time.Minute {
+		lines = append(lines, "Not recorded: "+formatHoursMinutes(gap))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func formatHoursMinutes(d time.Duration) string {
+	d = d.Round(time.Minute)
+	return fmt.Sprintf("%dh %02dm", int(d.Hours()), int(d.Minutes())%60)
+}
+
+func sameDay(a, b time.Time) bool {
+	ay, am, ad := a.Date()
+	by, bm, bd := b.Date()
+	return ay == by && am == bm && ad == bd
+}
+
+func parseStatsDay(arg string, now time.Time, loc *time.Location) (time.Time, error) {
+	now = now.In(loc)
+	switch arg = strings.ToLower(strings.TrimSpace(arg)); arg {
+	case "", "today":
+		return startOfDay(now), nil
+	case "yesterday":
+		return startOfDay(now).AddDate(0, 0, -1), nil
+	}
+	day, err := time.ParseInLocation("2006-01-02", arg, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid day %q, expected today, yesterday or YYYY-MM-DD", arg)
+	}
+	return day, nil
+}
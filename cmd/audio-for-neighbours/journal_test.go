@@ -0,0 +1,31 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestJournal(t *testing.T) {
+	j := newJournal(filepath.Join(t.TempDir(), "journal.jsonl"))
+	bus := newEventBus(10)
+	bus.setSink(j.append)
+	start := time.Date(2026, time.January, 5, 8, 0, 0, 0, time.UTC)
+	bus.publish(appEvent{Time: start, Type: eventService, Action: "start"})
+	bus.publish(appEvent{Time: start.Add(time.Minute), Type: eventState, Action: "pause", Trigger: "schedule", Reasons: []string{"schedule"}})
+
+	events, err := j.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[0].Action != "start" || events[1].Action != "pause" || events[1].ID != events[0].ID+1 {
+		t.Fatalf("events = %+v", events)
+	}
+	text, err := j.history(1, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Last 1 events:\nJan 5 08:01 state pause (schedule) - schedule"; text != want {
+		t.Errorf("history = %q, want %q", text, want)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const libraryOrderFile = ".order"
+
+func readLibraryOrder(dir string) []string {
+	f, err := os.Open(filepath.Join(dir, libraryOrderFile))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var names []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		name := strings.TrimSpace(scanner.Text())
+		if name != "" && !strings.HasPrefix(name, "#") {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func writeLibraryOrder(dir string, names []string) error {
+	var b strings.Builder
+	for _, name := range names {
+		b.WriteString(filepath.Base(name))
+		b.WriteString("\n")
+	}
+	return writeFileAtomic(filepath.Join(dir, libraryOrderFile), []byte(b.String()))
+}
+
+func applyLibraryOrder(files []string, order []string) []string {
+	if len(order) == 0 {
+		return files
+	}
+	byName := make(map[string]string, len(files))
+	for _, file := range files {
+		byName[filepath.Base(file)] = file
+	}
+
+	ordered := make([]string, 0, len(files))
+	used := make(map[string]bool, len(files))
+	for _, name := range order {
+		if file, ok := byName[name]; ok && !used[name] {
+			ordered = append(ordered, file)
+			used[name] = true
+		}
+	}
+	for _, file := range files {
+		if !used[filepath.Base(file)] {
+			ordered = append(ordered, file)
+		}
+	}
+	return ordered
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
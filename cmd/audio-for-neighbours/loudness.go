@@ -0,0 +1,335 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultLoudnessFile     = "loudness.json"
+	defaultLoudnessTarget   = -18.0
+	defaultLoudnessMaxBoost = 10.0
+
+	// replayGainReference is the loudness that a ReplayGain of 0 dB stands
+	// for (ReplayGain 2.0).
+	replayGainReference = -18.0
+)
+
+type loudnessEntry struct {
+	Size    int64   `json:"size"`
+	ModTime int64   `json:"mod_time"`
+	LUFS    float64 `json:"lufs"`
+	Peak    float64 `json:"peak,omitempty"`
+	Source  string  `json:"source"`
+}
+
+// loudnessAnalyzer measures files in the background and keeps the results
+// in a JSON cache keyed by path, so a file is only decoded again after it
+// changes.
+type loudnessAnalyzer struct {
+	dir      string
+	path     string
+	target   float64
+	maxBoost float64
+	requests chan string
+
+	mu    sync.Mutex
+	cache map[string]loudnessEntry
+}
+
+func newLoudnessAnalyzer(dir, cachePath string, target, maxBoost float64) *loudnessAnalyzer {
+	l := &loudnessAnalyzer{
+		dir:      dir,
+		path:     cachePath,
+		target:   target,
+		maxBoost: maxBoost,
+		requests: make(chan string, 16),
+		cache:    make(map[string]loudnessEntry),
+	}
+	data, err := os.ReadFile(cachePath)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Printf("loudness cache load error: %v", err)
+		}
+		return l
+	}
+	if err := json.Unmarshal(data, &l.cache); err != nil {
+		log.Printf("loudness cache load error: %s: %v", cachePath, err)
+		l.cache = make(map[string]loudnessEntry)
+	}
+	return l
+}
+
+// gain returns the correction in dB for a file. Files that are not
+// analyzed yet play unchanged and are queued for the analyzer.
+func (l *loudnessAnalyzer) gain(path string) float64 {
+	entry, ok := l.lookup(path)
+	if !ok {
+		select {
+		case l.requests <- path:
+		default:
+		}
+		return 0
+	}
+	gain := min(l.target-entry.LUFS, l.maxBoost)
+	if entry.Peak > 0 {
+		gain = min(gain, -20*math.Log10(entry.Peak))
+	}
+	return gain
+}
+
+func (l *loudnessAnalyzer) lookup(path string) (loudnessEntry, bool) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return loudnessEntry{}, false
+	}
+	l.mu.Lock()
+	entry, ok := l.cache[path]
+	l.mu.Unlock()
+	if !ok || entry.Size != info.Size() || entry.ModTime != info.ModTime().UnixNano() {
+		return loudnessEntry{}, false
+	}
+	return entry, true
+}
+
+func (l *loudnessAnalyzer) run(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		l.analyzeDir(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case path := <-l.requests:
+			l.analyzeFile(path)
+		}
+	}
+}
+
+func (l *loudnessAnalyzer) analyzeDir(ctx context.Context) {
+	files, err := scanAudioFiles(l.dir)
+	if err != nil {
+		return
+	}
+	analyzed := 0
+	for _, file := range files {
+		if ctx.Err() != nil {
+			return
+		}
+		if _, ok := l.lookup(file); ok {
+			continue
+		}
+		if l.analyzeFile(file) {
+			analyzed++
+		}
+	}
+	l.prune()
+	if analyzed > 0 {
+		log.Printf("loudness: analyzed %d file(s)", analyzed)
+	}
+}
+
+func (l *loudnessAnalyzer) analyzeFile(path string) bool {
+	if _, ok := l.lookup(path); ok {
+		return false
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	entry, err := analyzeLoudness(path)
+	if err != nil {
+		log.Printf("loudness error: %s: %v", filepath.Base(path), err)
+		entry = loudnessEntry{LUFS: l.target, Source: "error"}
+	}
+	entry.Size = info.Size()
+	entry.ModTime = info.ModTime().UnixNano()
+
+	l.mu.Lock()
+	l.cache[path] = entry
+	l.mu.Unlock()
+	l.save()
+	return true
+}
+
+// prune drops cache entries for files that no longer exist.
+func (l *loudnessAnalyzer) prune() {
+	l.mu.Lock()
+	removed := false
+	for path := range l.cache {
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			delete(l.cache, path)
+			removed = true
+		}
+	}
+	l.mu.Unlock()
+	if removed {
+		l.save()
+	}
+}
+
+func (l *loudnessAnalyzer) save() {
+	l.mu.Lock()
+	data, err := json.MarshalIndent(l.cache, "", "  ")
+	l.mu.Unlock()
+	if err != nil {
+		log.Printf("loudness cache encode error: %v", err)
+		return
+	}
+	if err := writeFileAtomic(l.path, append(data, '\n')); err != nil {
+		log.Printf("loudness cache save error: %v", err)
+	}
+}
+
+// analyzeLoudness prefers a ReplayGain track tag and measures the file
+// otherwise.
+func analyzeLoudness(path string) (loudnessEntry, error) {
+	if gain, peak, ok := readReplayGain(path); ok {
+		return loudnessEntry{LUFS: replayGainReference - gain, Peak: peak, Source: "replaygain"}, nil
+	}
+	lufs, peak, err := measureLoudness(path)
+	if err != nil {
+		return loudnessEntry{}, err
+	}
+	return loudnessEntry{LUFS: lufs, Peak: peak, Source: "r128"}, nil
+}
+
+var (
+	replayGainTag  = regexp.MustCompile(`(?i)replaygain_track_gain[\x00=]+\s*([+-]?\d+(?:\.\d+)?)\s*dB`)
+	replayPeakTag  = regexp.MustCompile(`(?i)replaygain_track_peak[\x00=]+\s*(\d+(?:\.\d+)?)`)
+	replayGainScan = int64(256 << 10)
+)
+
+// readReplayGain looks for the track gain in the tags at the start and end
+// of the file: ID3v2 TXXX frames, FLAC and Vorbis comments and APE tags all
+// store it as plain text next to its name.
+func readReplayGain(path string) (gain, peak float64, ok bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, false
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return 0, 0, false
+	}
+
+	head := make([]byte, min(info.Size(), replayGainScan))
+	if _, err := io.ReadFull(f, head); err != nil {
+		return 0, 0, false
+	}
+	var tail []byte
+	if info.Size() > replayGainScan {
+		tail = make([]byte, min(info.Size()-replayGainScan, 16<<10))
+		if _, err := f.ReadAt(tail, info.Size()-int64(len(tail))); err != nil {
+			tail = nil
+		}
+	}
+
+	for _, buf := range [][]byte{head, tail} {
+		m := replayGainTag.FindSubmatch(buf)
+		if m == nil {
+			continue
+		}
+		gain, err := strconv.ParseFloat(string(m[1]), 64)
+		if err != nil {
+			continue
+		}
+		if p := replayPeakTag.FindSubmatch(buf); p != nil {
+			peak, _ = strconv.ParseFloat(string(p[1]), 64)
+		}
+		return gain, peak, true
+	}
+	return 0, 0, false
+}
+
+// measureLoudness returns the integrated loudness (EBU R128 / ITU-R
+// BS.1770) and the sample peak of a file.
+func measureLoudness(path string) (lufs, peak float64, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	streamer, format, err := decodeAudio(f, path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer streamer.Close()
+
+	filters := kWeighting(float64(format.SampleRate))
+	step := format.SampleRate.N(100 * time.Millisecond)
+	if step <= 0 {
+		return 0, 0, fmt.Errorf("invalid sample rate %d", format.SampleRate)
+	}
+
+	// Mean square per 100 ms; a gating block is four of them (400 ms with
+	// 75% overlap).
+	var steps []float64
+	sum, n := 0.0, 0
+	buf := make([][2]float64, 4096)
+	for {
+		count, ok := streamer.Stream(buf)
+		for _, s := range buf[:count] {
+			for ch := range 2 {
+				peak = max(peak, math.Abs(s[ch]))
+				y := filters[1].process(filters[0].process(s[ch], ch), ch)
+				sum += y * y
+			}
+			if n++; n == step {
+				steps = append(steps, sum/float64(step))
+				sum, n = 0, 0
+			}
+		}
+		if !ok {
+			break
+		}
+	}
+	if err := streamer.Err(); err != nil {
+		return 0, 0, err
+	}
+
+	var blocks []float64
+	for i := 3; i < len(steps); i++ {
+		power := (steps[i-3] + steps[i-2] + steps[i-1] + steps[i]) / 4
+		if blockLoudness(power) > -70 {
+			blocks = append(blocks, power)
+		}
+	}
+	if len(blocks) == 0 {
+		return -70, peak, nil
+	}
+	relative := blockLoudness(mean(blocks)) - 10
+	var gated []float64
+	for _, power := range blocks {
+		if blockLoudness(power) > relative {
+			gated = append(gated, power)
+		}
+	}
+	return blockLoudness(mean(gated)), peak, nil
+}
+
+func blockLoudness(power float64) float64 {
+	return -0.691 + 10*math.Log10(power)
+}
+
+func mean(values []float64) float64 {
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
@@ -4,33 +4,66 @@ import (
 	"context"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
+	_ "time/tzdata"
 )
 
 func main() {
-	ctx := context.Background()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	cfg, err := loadConfig("config.yaml")
+	cfg, err := loadConfig(configPath)
 	if err != nil {
 		log.Fatalf("load config: %v", err)
 	}
 	appConfig = cfg
 
-	player := newAudioPlayer(appConfig.AudioDir)
-	notifier, err := newTelegramNotifier(appConfig.Telegram.Token, appConfig.Telegram.ChatID)
+	output, err := newOutput(appConfig.Output)
+	if err != nil {
+		log.Fatalf("audio output: %v", err)
+	}
+	player := newAudioPlayer(appConfig.AudioDir, appConfig.PlaylistDir, output)
+	player.setVolume(appConfig.Volume)
+	player.setMode(appConfig.PlaybackMode)
+	if appConfig.Loudness {
+		loudness := newLoudnessAnalyzer(appConfig.AudioDir, appConfig.LoudnessFile, appConfig.LoudnessTarget, appConfig.LoudnessMaxBoost)
+		player.setLoudness(loudness)
+		go loudness.run(ctx)
+	}
+	player.setFade(appConfig.FadeIn, appConfig.FadeOut, appConfig.Crossfade)
+	player.setDSPPresets(appConfig.DSP.Presets)
+	if err := player.setDSP(appConfig.DSP.Preset); err != nil {
+		log.Printf("dsp error: %v", err)
+	}
+	notifier, err := newTelegramNotifier(appConfig.Telegram)
 	if err != nil {
 		log.Printf("telegram init error: %v", err)
 	}
 
-	app := newApp(player, notifier)
+	app := newApp(player, notifier, newNotifierSet(appConfig.Notifiers, notifier))
+	app.setJournal(newJournal(appConfig.JournalFile))
+	app.events.publish(appEvent{Type: eventService, Action: "start"})
+	app.restoreState(newStateStore(appConfig.StateFile))
 
 	go player.run(ctx)
 	go app.runFileNotifications(ctx)
 	go app.runScheduleLoop(ctx)
+	go app.runLibraryWatch(ctx)
 	go app.runPresenceEvents(ctx)
+	go app.runPlaybackMetrics(ctx)
+	go app.runStatePersistence(ctx)
 
 	if notifier != nil {
-		go notifier.run(ctx, app.handleCommand)
+		go notifier.run(ctx, app.handleCommand, app.statusText)
+	}
+	if bridge := newMQTTBridge(appConfig.MQTT, app); bridge != nil {
+		go bridge.run(ctx)
+	}
+	if api := newHTTPAPI(appConfig.HTTP, app); api != nil {
+		go api.run(ctx)
 	}
 
 	client := &http.Client{
@@ -53,5 +86,9 @@ func main() {
 	routerClient := newRouterClient(appConfig.Router.BaseURL, appConfig.Router.Username, appConfig.Router.Password, appConfig.Router.Lang)
 	go pollPresence(ctx, routerClient, appConfig.PresenceTargets, app.handlePresenceUpdate)
 
-	select {}
+	<-ctx.Done()
+	app.saveState()
+	app.events.publish(appEvent{Type: eventService, Action: "stop"})
+	app.journal.flush()
+	log.Printf("shutting down")
 }
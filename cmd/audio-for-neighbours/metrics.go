@@ -0,0 +1,70 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	metricPlayingSeconds = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "afn_playing_seconds_total",
+		Help: "Seconds playback was running.",
+	})
+	metricPausedSeconds = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "afn_paused_seconds_total",
+		Help: "Seconds playback was paused, by reason. Overlapping reasons are each counted.",
+	}, []string{"reason"})
+	metricPaused = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "afn_paused",
+		Help: "1 while playback is paused.",
+	})
+	metricVolume = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "afn_volume_percent",
+		Help: "Current output volume in percent.",
+	})
+
+	metricPullErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "afn_onvif_pull_messages_errors_total",
+		Help: "Failed ONVIF PullMessages calls.",
+	})
+	metricSubscriptions = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "afn_onvif_subscriptions_total",
+		Help: "ONVIF pull point subscriptions created, including resubscriptions.",
+	})
+	metricSubscriptionErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "afn_onvif_subscription_errors_total",
+		Help: "Failed attempts to create an ONVIF pull point subscription.",
+	})
+
+	metricRouterLoginFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "afn_router_login_failures_total",
+		Help: "Failed router logins.",
+	})
+	metricPresenceErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "afn_presence_check_errors_total",
+		Help: "Failed presence checks against the router.",
+	})
+
+	metricSnapshotDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "afn_snapshot_fetch_seconds",
+		Help:    "Time taken to fetch a camera snapshot.",
+		Buckets: []float64{0.1, 0.25, 0.5, 1, 2, 5, 10},
+	})
+	metricSnapshotFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "afn_snapshot_failures_total",
+		Help: "Failed camera snapshot fetches.",
+	})
+
+	metricTelegramFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "afn_telegram_send_failures_total",
+		Help: "Failed Telegram API sends.",
+	})
+)
+
+var pauseMetricReasons = []string{"schedule", "motion", "presence", "manual"}
+
+func init() {
+	for _, reason := range pauseMetricReasons {
+		metricPausedSeconds.WithLabelValues(reason)
+	}
+}
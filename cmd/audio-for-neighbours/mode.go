@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type playbackMode string
+
+const (
+	modeSequential playbackMode = "sequential"
+	modeShuffle    playbackMode = "shuffle"
+	modeWeighted   playbackMode = "weighted"
+)
+
+const weightsFile = ".weights"
+
+func parsePlaybackMode(value string) (playbackMode, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", "sequential", "order", "loop":
+		return modeSequential, nil
+	case "shuffle":
+		return modeShuffle, nil
+	case "weighted", "random":
+		return modeWeighted, nil
+	}
+	return "", fmt.Errorf("unknown playback mode %q (sequential, shuffle or weighted)", value)
+}
+
+// filenameWeight matches a weight at the end of the file name, e.g.
+// "rain@3.mp3".
+var filenameWeight = regexp.MustCompile(`@(\d+(?:\.\d+)?)$`)
+
+// readWeights reads the sidecar file of a folder: one "name = weight" per
+// line, '#' starts a comment.
+func readWeights(dir string) map[string]float64 {
+	f, err := os.Open(filepath.Join(dir, weightsFile))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	weights := make(map[string]float64)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		i := strings.LastIndex(text, "=")
+		if i < 0 {
+			continue
+		}
+		weight, err := strconv.ParseFloat(strings.TrimSpace(text[i+1:]), 64)
+		if err != nil || weight <= 0 {
+			continue
+		}
+		weights[strings.TrimSpace(text[:i])] = weight
+	}
+	return weights
+}
+
+// resolveWeights fills in the weight of every entry that has none from its
+// playlist: the sidecar file in the entry's folder, then the file name,
+// then 1.
+func resolveWeights(entries []playlistEntry) {
+	sidecars := make(map[string]map[string]float64)
+	for i := range entries {
+		if entries[i].weight > 0 {
+			continue
+		}
+		if isGenerator(entries[i].path) {
+			entries[i].weight = 1
+			continue
+		}
+		dir, name := filepath.Split(entries[i].path)
+		weights, ok := sidecars[dir]
+		if !ok {
+			weights = readWeights(dir)
+			sidecars[dir] = weights
+		}
+		if w, ok := weights[name]; ok {
+			entries[i].weight = w
+			continue
+		}
+		entries[i].weight = 1
+		if m := filenameWeight.FindStringSubmatch(strings.TrimSuffix(name, filepath.Ext(name))); m != nil {
+			if w, err := strconv.ParseFloat(m[1], 64); err == nil && w > 0 {
+				entries[i].weight = w
+			}
+		}
+	}
+}
+
+// pickShuffle returns an entry not yet played in this round, starting a new
+// round once all have played. A file listed several times plays that many
+// times per round. The last file of a round never opens the next one
+// unless it is the only one.
+func (s *sequencer) pickShuffle(entries []playlistEntry) int {
+	listed := make(map[string]int, len(entries))
+	for _, entry := range entries {
+		listed[entry.path]++
+	}
+	var candidates []int
+	for i, entry := range entries {
+		if s.played[entry.path] < listed[entry.path] {
+			candidates = append(candidates, i)
+		}
+	}
+	if len(candidates) == 0 {
+		clear(s.played)
+		for i, entry := range entries {
+			if entry.path != s.lastPath {
+				candidates = append(candidates, i)
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		for i := range entries {
+			candidates = append(candidates, i)
+		}
+	}
+	i := candidates[rand.IntN(len(candidates))]
+	s.played[entries[i].path]++
+	return i
+}
+
+// pickWeighted draws an entry with probability proportional to its weight,
+// avoiding the file that just played when there is another one.
+func (s *sequencer) pickWeighted(entries []playlistEntry) int {
+	total := 0.0
+	for _, entry := range entries {
+		if entry.path != s.lastPath || len(entries) == 1 {
+			total += entry.weight
+		}
+	}
+	r := rand.Float64() * total
+	last := 0
+	for i, entry := range entries {
+		if entry.path == s.lastPath && len(entries) > 1 {
+			continue
+		}
+		last = i
+		if r -= entry.weight; r < 0 {
+			return i
+		}
+	}
+	return last
+}
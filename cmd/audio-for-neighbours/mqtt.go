@@ -0,0 +1,303 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+type MQTTConfig struct {
+	Broker          string `yaml:"broker"`
+	Username        string `yaml:"username"`
+	Password        string `yaml:"password"`
+	ClientID        string `yaml:"client_id"`
+	TopicPrefix     string `yaml:"topic_prefix"`
+	DiscoveryPrefix string `yaml:"discovery_prefix"`
+}
+
+// mqttCommandQueueSize is how many commands may wait while an earlier one,
+// such as a fade-out, is still running.
+const mqttCommandQueueSize = 16
+
+type mqttBridge struct {
+	app       *app
+	client    mqtt.Client
+	prefix    string
+	discovery string
+	nodeID    string
+	commands  chan func()
+
+	mu        sync.Mutex
+	published map[string]string
+}
+
+func newMQTTBridge(cfg MQTTConfig, a *app) *mqttBridge {
+	if cfg.Broker == "" {
+		return nil
+	}
+	prefix := strings.TrimRight(cfg.TopicPrefix, "/")
+	if prefix == "" {
+		prefix = "audio-for-neighbours"
+	}
+	discovery := strings.TrimRight(cfg.DiscoveryPrefix, "/")
+	if discovery == "" {
+		discovery = "homeassistant"
+	}
+	clientID := cfg.ClientID
+	if clientID == "" {
+		clientID = "audio-for-neighbours"
+	}
+
+	b := &mqttBridge{
+		app:       a,
+		prefix:    prefix,
+		discovery: discovery,
+		nodeID:    strings.NewReplacer("/", "_", " ", "_").Replace(clientID),
+		published: make(map[string]string),
+		commands:  make(chan func(), mqttCommandQueueSize),
+	}
+
+	opts := mqtt.NewClientOptions().
+		AddBroker(cfg.Broker).
+		SetClientID(clientID).
+		SetUsername(cfg.Username).
+		SetPassword(cfg.Password).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetConnectRetryInterval(10*time.Second).
+		SetWill(b.topic("availability"), "offline", 1, true).
+		SetOnConnectHandler(b.onConnect).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			log.Printf("mqtt connection lost: %v", err)
+		})
+	b.client = mqtt.NewClient(opts)
+	return b
+}
+
+func (b *mqttBridge) run(ctx context.Context) {
+	b.client.Connect()
+	b.app.onStateChange(b.publishStatus)
+	for {
+		select {
+		case <-ctx.Done():
+			b.publish("availability", "offline")
+			b.client.Disconnect(250)
+			return
+		case cmd := <-b.commands:
+			cmd()
+		}
+	}
+}
+
+// enqueue hands a command to run's goroutine. Handlers run on the paho
+// client's own goroutine, which must not be held up by the player.
+func (b *mqttBridge) enqueue(cmd func()) {
+	select {
+	case b.commands <- cmd:
+	default:
+		log.Printf("mqtt: command queue full, dropping command")
+	}
+}
+
+func (b *mqttBridge) topic(name string) string {
+	return b.prefix + "/" + name
+}
+
+func (b *mqttBridge) onConnect(client mqtt.Client) {
+	log.Printf("mqtt connected")
+	b.mu.Lock()
+	b.published = make(map[string]string)
+	b.mu.Unlock()
+
+	b.publish("availability", "online")
+	b.publishDiscovery()
+	b.publishStatus(b.app.status())
+
+	handlers := map[string]mqtt.MessageHandler{
+		b.topic("command"):    b.handleCommand,
+		b.topic("switch/set"): b.handleSwitch,
+		b.topic("volume/set"): b.handleVolume,
+	}
+	for topic, handler := range handlers {
+		if token := client.Subscribe(topic, 1, handler); token.Wait() && token.Error() != nil {
+			log.Printf("mqtt subscribe %s error: %v", topic, token.Error())
+		}
+	}
+}
+
+func (b *mqttBridge) handleCommand(_ mqtt.Client, msg mqtt.Message) {
+	fields := strings.Fields(strings.ToLower(string(msg.Payload())))
+	if len(fields) == 0 {
+		return
+	}
+	if fields[0] == "volume" && len(fields) > 1 {
+		b.enqueue(func() { b.setVolume(fields[1]) })
+		return
+	}
+	switch fields[0] {
+	case "play", "pause", "auto", "skip":
+	default:
+		log.Printf("mqtt: unknown command %q", msg.Payload())
+		return
+	}
+	b.enqueue(func() {
+		resp := b.app.handleCommand(commandRequest{
+			name:   fields[0],
+			args:   strings.Join(fields[1:], " "),
+			source: "mqtt",
+			role:   roleOperator,
+		})
+		log.Printf("mqtt command %s: %s", fields[0], resp)
+	})
+}
+
+func (b *mqttBridge) handleSwitch(_ mqtt.Client, msg mqtt.Message) {
+	name := "pause"
+	if strings.EqualFold(string(msg.Payload()), "ON") {
+		name = "play"
+	}
+	b.enqueue(func() {
+		b.app.handleCommand(commandRequest{name: name, source: "mqtt", role: roleOperator})
+	})
+}
+
+func (b *mqttBridge) handleVolume(_ mqtt.Client, msg mqtt.Message) {
+	value := string(msg.Payload())
+	b.enqueue(func() { b.setVolume(value) })
+}
+
+func (b *mqttBridge) setVolume(value string) {
+	v, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		log.Printf("mqtt: invalid volume %q", value)
+		return
+	}
+	b.app.setVolume(int(v + 0.5))
+}
+
+func (b *mqttBridge) publishStatus(status appStatus) {
+	onOff := func(v bool) string {
+		if v {
+			return "ON"
+		}
+		return "OFF"
+	}
+	online, _ := json.Marshal(status.OnlineTargets)
+	reasons, _ := json.Marshal(status.Reasons)
+
+	b.publish("playing", onOff(!status.Paused))
+	b.publish("paused", onOff(status.Paused))
+	b.publish("reason/schedule", onOff(status.PausedBySchedule))
+	b.publish("reason/motion", onOff(status.PausedByMotion))
+	b.publish("reason/presence", onOff(status.PausedByPresence))
+	b.publish("reason/manual", onOff(status.PausedByManual))
+	b.publish("reason/forced", onOff(status.ForcePlay))
+	b.publish("reasons", string(reasons))
+	b.publish("current_file", status.CurrentFile)
+	b.publish("online", string(online))
+	b.publish("motion", onOff(status.Motion))
+	b.publish("volume", strconv.Itoa(status.Volume))
+}
+
+func (b *mqttBridge) publish(name, payload string) {
+	topic := b.topic(name)
+	b.mu.Lock()
+	if last, ok := b.published[topic]; ok && last == payload {
+		b.mu.Unlock()
+		return
+	}
+	b.published[topic] = payload
+	b.mu.Unlock()
+
+	if !b.client.IsConnectionOpen() {
+		return
+	}
+	b.client.Publish(topic, 1, true, payload)
+}
+
+func (b *mqttBridge) publishDiscovery() {
+	device := map[string]any{
+		"identifiers":  []string{b.nodeID},
+		"name":         "Audio for neighbours",
+		"manufacturer": "audio-for-neighbours",
+	}
+	entity := func(component, id, name string, extra map[string]any) {
+		payload := map[string]any{
+			"name":               name,
+			"unique_id":          b.nodeID + "_" + id,
+			"object_id":          b.nodeID + "_" + id,
+			"availability_topic": b.topic("availability"),
+			"device":             device,
+		}
+		for k, v := range extra {
+			payload[k] = v
+		}
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return
+		}
+		topic := fmt.Sprintf("%s/%s/%s/%s/config", b.discovery, component, b.nodeID, id)
+		b.client.Publish(topic, 1, true, data)
+	}
+
+	// Home Assistant has no MQTT media_player platform, so the player is
+	// described by the switch, the now-playing sensor, the volume number and
+	// the buttons below instead.
+	entity("switch", "playback", "Playback", map[string]any{
+		"state_topic":   b.topic("playing"),
+		"command_topic": b.topic("switch/set"),
+		"icon":          "mdi:speaker",
+	})
+	entity("sensor", "current_file", "Now playing", map[string]any{
+		"state_topic": b.topic("current_file"),
+		"icon":        "mdi:music",
+	})
+	entity("number", "volume", "Volume", map[string]any{
+		"state_topic":         b.topic("volume"),
+		"command_topic":       b.topic("volume/set"),
+		"min":                 0,
+		"max":                 100,
+		"step":                1,
+		"unit_of_measurement": "%",
+		"icon":                "mdi:volume-high",
+	})
+	entity("button", "skip", "Skip track", map[string]any{
+		"command_topic": b.topic("command"),
+		"payload_press": "skip",
+		"icon":          "mdi:skip-next",
+	})
+	entity("button", "auto", "Automatic control", map[string]any{
+		"command_topic": b.topic("command"),
+		"payload_press": "auto",
+		"icon":          "mdi:autorenew",
+	})
+	entity("sensor", "online", "Presence targets online", map[string]any{
+		"state_topic":    b.topic("online"),
+		"value_template": "{{ value_json | join(', ') }}",
+		"icon":           "mdi:account-multiple",
+	})
+
+	binarySensors := []struct{ id, name, topic, class string }{
+		{"paused", "Paused", "paused", ""},
+		{"paused_schedule", "Paused by schedule", "reason/schedule", ""},
+		{"paused_motion", "Paused by motion", "reason/motion", ""},
+		{"paused_presence", "Paused by presence", "reason/presence", ""},
+		{"paused_manual", "Paused manually", "reason/manual", ""},
+		{"forced_play", "Forced play", "reason/forced", ""},
+		{"motion", "Camera motion", "motion", "motion"},
+	}
+	for _, s := range binarySensors {
+		extra := map[string]any{"state_topic": b.topic(s.topic)}
+		if s.class != "" {
+			extra["device_class"] = s.class
+		}
+		entity("binary_sensor", s.id, s.name, extra)
+	}
+}
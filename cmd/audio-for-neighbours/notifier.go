@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+const (
+	// notifierTimeout bounds a single delivery on every backend.
+	notifierTimeout = 30 * time.Second
+	// notifierQueueSize is how far a slow backend may fall behind before
+	// its messages are dropped.
+	notifierQueueSize = 32
+)
+
+type Notifier interface {
+	Name() string
+	SendText(kind, text string) error
+	SendPhoto(kind, filename string, data []byte) error
+	SendVideo(kind, filename string, data []byte) error
+}
+
+type NotifierConfig struct {
+	Type     string            `yaml:"type"`
+	Events   []string          `yaml:"events"`
+	URL      string            `yaml:"url"`
+	Topic    string            `yaml:"topic"`
+	Token    string            `yaml:"token"`
+	Priority string            `yaml:"priority"`
+	Headers  map[string]string `yaml:"headers"`
+	Host     string            `yaml:"host"`
+	Port     int               `yaml:"port"`
+	Username string            `yaml:"username"`
+	Password string            `yaml:"password"`
+	From     string            `yaml:"from"`
+	To       []string          `yaml:"to"`
+	TLS      bool              `yaml:"tls"`
+}
+
+type notifierEntry struct {
+	notifier Notifier
+	events   map[string]bool
+	queue    chan func(Notifier) error
+}
+
+type notifierSet struct {
+	entries []notifierEntry
+}
+
+func newNotifier(cfg NotifierConfig) (Notifier, error) {
+	switch strings.ToLower(cfg.Type) {
+	case "ntfy":
+		return newNtfyNotifier(cfg)
+	case "webhook":
+		return newWebhookNotifier(cfg)
+	case "email", "smtp":
+		return newEmailNotifier(cfg)
+	default:
+		return nil, fmt.Errorf("unknown notifier type %q (want ntfy, webhook or email)", cfg.Type)
+	}
+}
+
+func validateNotifiers(cfgs []NotifierConfig) error {
+	for i, cfg := range cfgs {
+		if _, err := newNotifier(cfg); err != nil {
+			return fmt.Errorf("notifiers[%d]: %w", i, err)
+		}
+		if _, err := parseEventKinds(cfg.Events); err != nil {
+			return fmt.Errorf("notifiers[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func newNotifierSet(cfgs []NotifierConfig, telegram *telegramNotifier) *notifierSet {
+	set := &notifierSet{}
+	if telegram != nil {
+		events, _ := parseEventKinds(nil)
+		set.add(telegram, events)
+	}
+	for _, cfg := range cfgs {
+		n, err := newNotifier(cfg)
+		if err != nil {
+			log.Printf("notifier init error: %v", err)
+			continue
+		}
+		events, err := parseEventKinds(cfg.Events)
+		if err != nil {
+			log.Printf("notifier %s: %v", n.Name(), err)
+			continue
+		}
+		set.add(n, events)
+	}
+	return set
+}
+
+// add starts a sender for the backend, so a slow or unreachable one delays
+// only its own messages, in order, and never the caller.
+func (s *notifierSet) add(n Notifier, events map[string]bool) {
+	entry := notifierEntry{notifier: n, events: events, queue: make(chan func(Notifier) error, notifierQueueSize)}
+	s.entries = append(s.entries, entry)
+	go entry.run()
+}
+
+func (e notifierEntry) run() {
+	for send := range e.queue {
+		if err := send(e.notifier); err != nil {
+			log.Printf("notifier %s error: %v", e.notifier.Name(), err)
+		}
+	}
+}
+
+func (s *notifierSet) notify(kind, text string) {
+	s.each(kind, func(n Notifier) error {
+		return n.SendText(kind, text)
+	})
+}
+
+func (s *notifierSet) photo(kind, filename string, data []byte) {
+	s.each(kind, func(n Notifier) error {
+		return n.SendPhoto(kind, filename, data)
+	})
+}
+
+func (s *notifierSet) video(kind, filename string, data []byte) {
+	s.each(kind, func(n Notifier) error {
+		return n.SendVideo(kind, filename, data)
+	})
+}
+
+func (s *notifierSet) wants(kind string) bool {
+	if s == nil {
+		return false
+	}
+	for _, entry := range s.entries {
+		if entry.events[kind] {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *notifierSet) each(kind string, send func(Notifier) error) {
+	if s == nil {
+		return
+	}
+	for _, entry := range s.entries {
+		if !entry.events[kind] {
+			continue
+		}
+		select {
+		case entry.queue <- send:
+		default:
+			log.Printf("notifier %s: queue full, dropping %s message", entry.notifier.Name(), kind)
+		}
+	}
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type capturedRequest struct {
+	method string
+	path   string
+	header http.Header
+	body   []byte
+}
+
+func captureServer(t *testing.T) (*httptest.Server, <-chan capturedRequest) {
+	t.Helper()
+	requests := make(chan capturedRequest, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- capturedRequest{method: r.Method, path: r.URL.Path, header: r.Header.Clone(), body: body}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, requests
+}
+
+func nextRequest(t *testing.T, requests <-chan capturedRequest) capturedRequest {
+	t.Helper()
+	select {
+	case req := <-requests:
+		return req
+	case <-time.After(5 * time.Second):
+		t.Fatal("no request received")
+		return capturedRequest{}
+	}
+}
+
+func TestNtfyNotifier(t *testing.T) {
+	srv, requests := captureServer(t)
+	n, err := newNtfyNotifier(NotifierConfig{URL: srv.URL + "/", Topic: "porch", Token: "secret", Priority: "high"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := n.SendText(eventState, "Playback paused"); err != nil {
+		t.Fatal(err)
+	}
+	req := nextRequest(t, requests)
+	if req.method != http.MethodPost || req.path != "/porch" {
+		t.Errorf("got %s %s, want POST /porch", req.method, req.path)
+	}
+	if string(req.body) != "Playback paused" {
+		t.Errorf("body = %q", req.body)
+	}
+	for key, want := range map[string]string{
+		"Title":         "audio-for-neighbours: state",
+		"Tags":          "state",
+		"Priority":      "high",
+		"Authorization": "Bearer secret",
+	} {
+		if got := req.header.Get(key); got != want {
+			t.Errorf("%s = %q, want %q", key, got, want)
+		}
+	}
+
+	if err := n.SendPhoto(eventMotion, "motion.jpg", []byte{0xFF, 0xD8}); err != nil {
+		t.Fatal(err)
+	}
+	req = nextRequest(t, requests)
+	if req.method != http.MethodPut || req.header.Get("Filename") != "motion.jpg" || string(req.body) != "\xFF\xD8" {
+		t.Errorf("photo: got %s, Filename %q, body %q", req.method, req.header.Get("Filename"), req.body)
+	}
+}
+
+func TestNtfyNotifierStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "topic is forbidden", http.StatusForbidden)
+	}))
+	defer srv.Close()
+	n, _ := newNtfyNotifier(NotifierConfig{URL: srv.URL, Topic: "porch"})
+	err := n.SendText(eventState, "hello")
+	if err == nil || !strings.Contains(err.Error(), "topic is forbidden") {
+		t.Errorf("err = %v, want the server message", err)
+	}
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	srv, requests := captureServer(t)
+	n, err := newWebhookNotifier(NotifierConfig{URL: srv.URL + "/hook", Headers: map[string]string{"X-Token": "abc"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := n.SendText(eventFile, "Now playing: rain.mp3"); err != nil {
+		t.Fatal(err)
+	}
+	req := nextRequest(t, requests)
+	if req.method != http.MethodPost || req.path != "/hook" {
+		t.Errorf("got %s %s, want POST /hook", req.method, req.path)
+	}
+	if req.header.Get("Content-Type") != "application/json" || req.header.Get("X-Token") != "abc" {
+		t.Errorf("headers = %v", req.header)
+	}
+	var payload webhookPayload
+	if err := json.Unmarshal(req.body, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Event != eventFile || payload.Text != "Now playing: rain.mp3" || payload.Time.IsZero() || payload.Data != nil {
+		t.Errorf("payload = %+v", payload)
+	}
+
+	if err := n.SendVideo(eventMotion, "motion.mp4", []byte("video")); err != nil {
+		t.Fatal(err)
+	}
+	payload = webhookPayload{}
+	if err := json.Unmarshal(nextRequest(t, requests).body, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Event != eventMotion || payload.Filename != "motion.mp4" || payload.ContentType != "video/mp4" || string(payload.Data) != "video" {
+		t.Errorf("payload = %+v", payload)
+	}
+}
+
+type smtpMessage struct {
+	from string
+	to   []string
+	data string
+}
+
+// fakeSMTP accepts one message per connection without authentication or
+// STARTTLS.
+func fakeSMTP(t *testing.T) (string, int, <-chan smtpMessage) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	messages := make(chan smtpMessage, 10)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveSMTP(conn, messages)
+		}
+	}()
+	addr := ln.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port, messages
+}
+
+func serveSMTP(conn net.Conn, messages chan<- smtpMessage) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+	reply("220 localhost ESMTP")
+	var msg smtpMessage
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch verb {
+		case "EHLO", "HELO":
+			reply("250 localhost")
+		case "MAIL":
+			msg.from = strings.Trim(strings.TrimPrefix(line, "MAIL FROM:"), "<>")
+			reply("250 OK")
+		case "RCPT":
+			msg.to = append(msg.to, strings.Trim(strings.TrimPrefix(line, "RCPT TO:"), "<>"))
+			reply("250 OK")
+		case "DATA":
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(line)
+			}
+			msg.data = data.String()
+			messages <- msg
+			msg = smtpMessage{}
+			reply("250 OK")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func TestEmailNotifier(t *testing.T) {
+	host, port, messages := fakeSMTP(t)
+	n, err := newEmailNotifier(NotifierConfig{Host: host, Port: port, From: "player@example.com", To: []string{"a@example.com", "b@example.com"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := n.SendText(eventPresence, "Presence online: phone"); err != nil {
+		t.Fatal(err)
+	}
+	msg := <-messages
+	if msg.from != "player@example.com" || strings.Join(msg.to, ",") != "a@example.com,b@example.com" {
+		t.Errorf("envelope = %s -> %v", msg.from, msg.to)
+	}
+	if !strings.Contains(msg.data, "Subject: audio-for-neighbours: presence\r\n") || !strings.Contains(msg.data, "\r\n\r\nPresence online: phone\r\n") {
+		t.Errorf("message = %q", msg.data)
+	}
+
+	if err := n.SendPhoto(eventMotion, "motion.jpg", []byte("jpeg")); err != nil {
+		t.Fatal(err)
+	}
+	msg = <-messages
+	for _, want := range []string{"multipart/mixed", "Content-Type: image/jpeg", `filename="motion.jpg"`, "anBlZw=="} {
+		if !strings.Contains(msg.data, want) {
+			t.Errorf("message does not contain %q:\n%s", want, msg.data)
+		}
+	}
+}
+
+func TestEmailNotifierTimeout(t *testing.T) {
+	// A server that accepts but never greets must not hang the sender.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		if conn, err := ln.Accept(); err == nil {
+			<-done
+			conn.Close()
+		}
+	}()
+	n, _ := newEmailNotifier(NotifierConfig{Host: "127.0.0.1", Port: ln.Addr().(*net.TCPAddr).Port, From: "a@example.com", To: []string{"b@example.com"}})
+	n.timeout = 100 * time.Millisecond
+	if err := n.SendText(eventState, "hello"); err == nil {
+		t.Error("expected a timeout error")
+	}
+}
+
+type recordingNotifier struct {
+	name  string
+	sent  chan string
+	block chan struct{}
+}
+
+func (r *recordingNotifier) Name() string { return r.name }
+
+func (r *recordingNotifier) SendText(kind, text string) error {
+	if r.block != nil {
+		<-r.block
+	}
+	r.sent <- kind + ": " + text
+	return nil
+}
+
+func (r *recordingNotifier) SendPhoto(kind, filename string, data []byte) error {
+	return r.SendText(kind, filename)
+}
+
+func (r *recordingNotifier) SendVideo(kind, filename string, data []byte) error {
+	return r.SendText(kind, filename)
+}
+
+func TestNotifierSetEvents(t *testing.T) {
+	states := &recordingNotifier{name: "states", sent: make(chan string, 10)}
+	motion := &recordingNotifier{name: "motion", sent: make(chan string, 10)}
+	events, err := parseEventKinds([]string{"motion"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	set := &notifierSet{}
+	set.add(states, map[string]bool{eventState: true})
+	set.add(motion, events)
+
+	if !set.wants(eventMotion) || set.wants(eventPresence) {
+		t.Error("wants does not follow the event filters")
+	}
+	set.notify(eventMotion, "first")
+	set.notify(eventState, "second")
+	set.photo(eventMotion, "motion.jpg", nil)
+	set.notify(eventState, "third")
+
+	for _, tc := range []struct {
+		n    *recordingNotifier
+		want []string
+	}{
+		{states, []string{"state: second", "state: third"}},
+		{motion, []string{"motion: first", "motion: motion.jpg"}},
+	} {
+		for _, want := range tc.want {
+			select {
+			case got := <-tc.n.sent:
+				if got != want {
+					t.Errorf("%s got %q, want %q", tc.n.name, got, want)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("%s did not receive %q", tc.n.name, want)
+			}
+		}
+	}
+}
+
+func TestNotifierSetSlowBackend(t *testing.T) {
+	slow := &recordingNotifier{name: "slow", sent: make(chan string, notifierQueueSize+10), block: make(chan struct{})}
+	fast := &recordingNotifier{name: "fast", sent: make(chan string, notifierQueueSize+10)}
+	set := &notifierSet{}
+	set.add(slow, map[string]bool{eventState: true})
+	set.add(fast, map[string]bool{eventState: true})
+
+	done := make(chan struct{})
+	go func() {
+		for i := range notifierQueueSize + 5 {
+			set.notify(eventState, strconv.Itoa(i))
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("a blocked backend held up the caller")
+	}
+	select {
+	case got := <-fast.sent:
+		if got != "state: 0" {
+			t.Errorf("fast got %q", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("a blocked backend held up the others")
+	}
+	close(slow.block)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+type ntfyNotifier struct {
+	url      string
+	token    string
+	priority string
+	client   *http.Client
+}
+
+func newNtfyNotifier(cfg NotifierConfig) (*ntfyNotifier, error) {
+	if cfg.URL == "" || cfg.Topic == "" {
+		return nil, fmt.Errorf("ntfy notifier needs url and topic")
+	}
+	return &ntfyNotifier{
+		url:      strings.TrimRight(cfg.URL, "/") + "/" + cfg.Topic,
+		token:    cfg.Token,
+		priority: cfg.Priority,
+		client:   &http.Client{Timeout: notifierTimeout},
+	}, nil
+}
+
+func (n *ntfyNotifier) Name() string {
+	return "ntfy"
+}
+
+func (n *ntfyNotifier) SendText(kind, text string) error {
+	return n.publish(http.MethodPost, kind, "", strings.NewReader(text))
+}
+
+func (n *ntfyNotifier) SendPhoto(kind, filename string, data []byte) error {
+	return n.publish(http.MethodPut, kind, filename, bytes.NewReader(data))
+}
+
+func (n *ntfyNotifier) SendVideo(kind, filename string, data []byte) error {
+	return n.publish(http.MethodPut, kind, filename, bytes.NewReader(data))
+}
+
+func (n *ntfyNotifier) publish(method, kind, filename string, body io.Reader) error {
+	req, err := http.NewRequest(method, n.url, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Title", "audio-for-neighbours: "+kind)
+	req.Header.Set("Tags", kind)
+	if filename != "" {
+		req.Header.Set("Filename", filename)
+	}
+	if n.priority != "" {
+		req.Header.Set("Priority", n.priority)
+	}
+	if n.token != "" {
+		req.Header.Set("Authorization", "Bearer "+n.token)
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 2048))
+		return fmt.Errorf("ntfy status %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
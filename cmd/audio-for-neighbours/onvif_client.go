@@ -51,17 +51,20 @@ func pollMotion(ctx context.Context, client *http.Client, dev *onvif.Device, onU
 			subEndpoint, refParams, err := createSubscription(client, dev)
 			if err != nil {
 				log.Printf("create pull point subscription error: %v", err)
+				metricSubscriptionErrors.Inc()
 				time.Sleep(5 * time.Second)
 				continue
 			}
 			endpoint = subEndpoint
 			referenceParams = refParams
+			metricSubscriptions.Inc()
 			log.Printf("subscription endpoint: %s", endpoint)
 		}
 
 		body, err := callPullMessages(client, endpoint, referenceParams)
 		if err != nil {
 			log.Printf("pull messages error: %v", err)
+			metricPullErrors.Inc()
 			endpoint = ""
 			referenceParams = nil
 			time.Sleep(3 * time.Second)
@@ -345,6 +348,17 @@ func newSnapshotter(client *http.Client, dev *onvif.Device) *snapshotter {
 }
 
 func (s *snapshotter) getSnapshot(ctx context.Context) ([]byte, error) {
+	start := time.Now()
+	data, err := s.fetchCurrent(ctx)
+	if err != nil {
+		metricSnapshotFailures.Inc()
+		return nil, err
+	}
+	metricSnapshotDuration.Observe(time.Since(start).Seconds())
+	return data, nil
+}
+
+func (s *snapshotter) fetchCurrent(ctx context.Context) ([]byte, error) {
 	snapshotURL, err := s.getSnapshotURL(ctx)
 	if err != nil {
 		return nil, err
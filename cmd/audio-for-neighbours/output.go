@@ -0,0 +1,342 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/faiface/beep"
+	"github.com/faiface/beep/speaker"
+)
+
+const defaultOutputBuffer = 100 * time.Millisecond
+
+type OutputConfig struct {
+	Type   string `yaml:"type"`
+	Device string `yaml:"device"`
+	Buffer string `yaml:"buffer"`
+	Path   string `yaml:"path"`
+}
+
+// Output is where the player's single mixed stream goes. Lock and Unlock
+// guard changes to the playing streamers, like speaker.Lock.
+type Output interface {
+	Init(rate beep.SampleRate) error
+	Play(s beep.Streamer)
+	Lock()
+	Unlock()
+}
+
+// outputMarker is implemented by outputs that record which file starts at
+// which point of the stream.
+type outputMarker interface {
+	Mark(name string)
+}
+
+func newOutput(cfg OutputConfig) (Output, error) {
+	buffer, err := parseOptionalDuration(cfg.Buffer, defaultOutputBuffer)
+	if err != nil || buffer <= 0 {
+		return nil, fmt.Errorf("output: invalid buffer %q", cfg.Buffer)
+	}
+	switch strings.ToLower(cfg.Type) {
+	case "", "speaker", "alsa":
+		card, device, err := parseALSADevice(cfg.Device)
+		if err != nil {
+			return nil, fmt.Errorf("output: %w", err)
+		}
+		return &speakerOutput{card: card, device: device, buffer: buffer}, nil
+	case "file", "wav":
+		if cfg.Path == "" {
+			return nil, fmt.Errorf("output: path is required for the file output")
+		}
+		return &pacedOutput{buffer: buffer, sink: &wavSink{path: cfg.Path}}, nil
+	case "null", "none":
+		return &pacedOutput{buffer: buffer}, nil
+	default:
+		return nil, fmt.Errorf("output: unknown type %q (want speaker, file or null)", cfg.Type)
+	}
+}
+
+// speakerOutput plays through beep's speaker (oto on ALSA). oto always
+// opens the "default" PCM, so a device is selected through the variables
+// ALSA reads for that PCM.
+type speakerOutput struct {
+	card   string
+	device string
+	buffer time.Duration
+}
+
+// alsaPluginPCMs are PCM names people put in device that are not cards.
+var alsaPluginPCMs = []string{"sysdefault", "plughw", "dmix", "dsnoop", "bluealsa", "pulse", "pipewire", "jack", "null"}
+
+// parseALSADevice splits "hw:1,0", "1,0", "1" or a card name like "Device"
+// into card and device number. Named PCMs cannot be reached through the
+// default PCM's variables and are rejected.
+func parseALSADevice(value string) (string, string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" || value == "default" {
+		return "", "", nil
+	}
+	spec := strings.TrimPrefix(value, "hw:")
+	card, device, _ := strings.Cut(spec, ",")
+	name, _, _ := strings.Cut(strings.ToLower(value), ":")
+	if containsString(alsaPluginPCMs, name) || strings.ContainsAny(spec, ":=") || !isALSAName(card) {
+		return "", "", fmt.Errorf("device %q is not a sound card; only cards (hw:1,0, 1 or a card name) can be selected, point the default PCM at other devices in ~/.asoundrc instead", value)
+	}
+	if _, err := strconv.Atoi(device); device != "" && err != nil {
+		return "", "", fmt.Errorf("device %q: invalid device number %q", value, device)
+	}
+	return card, device, nil
+}
+
+func isALSAName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+func (o *speakerOutput) Init(rate beep.SampleRate) error {
+	if o.card != "" {
+		os.Setenv("ALSA_PCM_CARD", o.card)
+		if o.device != "" {
+			os.Setenv("ALSA_PCM_DEVICE", o.device)
+		}
+	}
+	return speaker.Init(rate, rate.N(o.buffer))
+}
+
+func (o *speakerOutput) Play(s beep.Streamer) {
+	speaker.Play(s)
+}
+
+func (o *speakerOutput) Lock() {
+	speaker.Lock()
+}
+
+func (o *speakerOutput) Unlock() {
+	speaker.Unlock()
+}
+
+// pacedOutput pulls from the streamers at the rate a sound card would, so
+// pauses, fades and schedules behave as with real hardware. Without a sink
+// the samples are dropped.
+type pacedOutput struct {
+	buffer time.Duration
+	sink   *wavSink
+
+	mu    sync.Mutex
+	mixer beep.Mixer
+}
+
+func (o *pacedOutput) Init(rate beep.SampleRate) error {
+	if o.sink != nil {
+		if err := o.sink.open(rate); err != nil {
+			return err
+		}
+	}
+	go o.run(rate, rate.N(o.buffer))
+	return nil
+}
+
+func (o *pacedOutput) run(rate beep.SampleRate, size int) {
+	buf := make([][2]float64, size)
+	start := time.Now()
+	written := 0
+	for {
+		o.mu.Lock()
+		o.mixer.Stream(buf)
+		o.mu.Unlock()
+		if o.sink != nil {
+			if err := o.sink.write(buf); err != nil {
+				log.Printf("output file error: %v", err)
+			}
+		}
+		written += len(buf)
+		time.Sleep(time.Until(start.Add(rate.D(written))))
+	}
+}
+
+func (o *pacedOutput) Play(s beep.Streamer) {
+	o.mu.Lock()
+	o.mixer.Add(s)
+	o.mu.Unlock()
+}
+
+func (o *pacedOutput) Lock() {
+	o.mu.Lock()
+}
+
+func (o *pacedOutput) Unlock() {
+	o.mu.Unlock()
+}
+
+func (o *pacedOutput) Mark(name string) {
+	if o.sink != nil {
+		o.sink.mark(name)
+	}
+}
+
+// silenceLevel is the peak below which a buffer counts as silence (about
+// -80 dBFS).
+const silenceLevel = 1e-4
+
+// wavMaxFrames keeps a WAV file within the 4 GiB that its 32-bit RIFF
+// sizes can describe, about 6.7 hours at 44.1 kHz.
+const wavMaxFrames = (math.MaxUint32 - 36) / 4
+
+// wavSink records the output as 16-bit stereo WAV. Next to it, a ".log"
+// file gets one line per event with the wall-clock time and the offset in
+// the recording: "play <file>" when a file starts and "sound" or "silence"
+// when the output changes between the two. When a WAV file is full, the
+// recording continues in "<name>.1.wav", "<name>.2.wav" and so on, logged
+// as "file <name>"; offsets keep counting from the start of the first file.
+type wavSink struct {
+	path      string
+	maxFrames int
+
+	mu      sync.Mutex
+	file    *os.File
+	events  *os.File
+	rate    beep.SampleRate
+	part    int
+	frames  int
+	total   int
+	silent  bool
+	started bool
+	marks   []string
+	pcm     []byte
+}
+
+func (w *wavSink) open(rate beep.SampleRate) error {
+	if w.maxFrames <= 0 {
+		w.maxFrames = wavMaxFrames
+	}
+	events, err := os.Create(strings.TrimSuffix(w.path, ".wav") + ".log")
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	w.events, w.rate = events, rate
+	w.mu.Unlock()
+	return w.create(w.path)
+}
+
+func (w *wavSink) create(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w.file, w.frames = file, 0
+	if err := w.writeHeader(); err != nil {
+		return err
+	}
+	_, err = file.Seek(44, io.SeekStart)
+	return err
+}
+
+// rotate finishes the full file and continues in the next part.
+func (w *wavSink) rotate() error {
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+	w.part++
+	path := fmt.Sprintf("%s.%d.wav", strings.TrimSuffix(w.path, ".wav"), w.part)
+	w.logEvent(time.Now(), w.rate.D(w.total), "file "+filepath.Base(path))
+	return w.create(path)
+}
+
+func (w *wavSink) mark(name string) {
+	w.mu.Lock()
+	w.marks = append(w.marks, name)
+	w.mu.Unlock()
+}
+
+func (w *wavSink) write(samples [][2]float64) error {
+	w.mu.Lock()
+	marks := w.marks
+	w.marks = nil
+	w.mu.Unlock()
+
+	now := time.Now()
+	offset := w.rate.D(w.total)
+	for _, name := range marks {
+		w.logEvent(now, offset, "play "+name)
+	}
+	peak := 0.0
+	for _, s := range samples {
+		peak = max(peak, math.Abs(s[0]), math.Abs(s[1]))
+	}
+	if silent := peak < silenceLevel; silent != w.silent || !w.started {
+		w.silent, w.started = silent, true
+		event := "sound"
+		if silent {
+			event = "silence"
+		}
+		w.logEvent(now, offset, event)
+	}
+
+	for len(samples) > 0 {
+		if w.frames >= w.maxFrames {
+			if err := w.rotate(); err != nil {
+				return err
+			}
+		}
+		n := min(len(samples), w.maxFrames-w.frames)
+		w.pcm = w.pcm[:0]
+		for _, s := range samples[:n] {
+			for _, v := range s {
+				v = max(-1, min(1, v))
+				w.pcm = binary.LittleEndian.AppendUint16(w.pcm, uint16(int16(v*(1<<15-1))))
+			}
+		}
+		if _, err := w.file.Write(w.pcm); err != nil {
+			return err
+		}
+		w.frames += n
+		w.total += n
+		samples = samples[n:]
+		// Keep the header current so the file is valid even if the process
+		// is killed.
+		if err := w.writeHeader(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *wavSink) logEvent(at time.Time, offset time.Duration, event string) {
+	fmt.Fprintf(w.events, "%s\t%.3f\t%s\n", at.Format(time.RFC3339Nano), offset.Seconds(), event)
+}
+
+func (w *wavSink) writeHeader() error {
+	dataLen := uint32(w.frames * 4)
+	header := make([]byte, 0, 44)
+	header = append(header, "RIFF"...)
+	header = binary.LittleEndian.AppendUint32(header, 36+dataLen)
+	header = append(header, "WAVEfmt "...)
+	header = binary.LittleEndian.AppendUint32(header, 16)
+	header = binary.LittleEndian.AppendUint16(header, 1)
+	header = binary.LittleEndian.AppendUint16(header, 2)
+	header = binary.LittleEndian.AppendUint32(header, uint32(w.rate))
+	header = binary.LittleEndian.AppendUint32(header, uint32(w.rate)*4)
+	header = binary.LittleEndian.AppendUint16(header, 4)
+	header = binary.LittleEndian.AppendUint16(header, 16)
+	header = append(header, "data"...)
+	header = binary.LittleEndian.AppendUint32(header, dataLen)
+	_, err := w.file.WriteAt(header, 0)
+	return err
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/faiface/beep"
+)
+
+// writeTone writes a 16-bit stereo sine WAV and backdates it so the library
+// scan does not wait for it to settle.
+func writeTone(t *testing.T, path string, rate beep.SampleRate, length time.Duration) {
+	t.Helper()
+	frames := rate.N(length)
+	data := make([]byte, 0, 44+frames*4)
+	data = append(data, "RIFF"...)
+	data = binary.LittleEndian.AppendUint32(data, uint32(36+frames*4))
+	data = append(data, "WAVEfmt "...)
+	data = binary.LittleEndian.AppendUint32(data, 16)
+	data = binary.LittleEndian.AppendUint16(data, 1)
+	data = binary.LittleEndian.AppendUint16(data, 2)
+	data = binary.LittleEndian.AppendUint32(data, uint32(rate))
+	data = binary.LittleEndian.AppendUint32(data, uint32(rate)*4)
+	data = binary.LittleEndian.AppendUint16(data, 4)
+	data = binary.LittleEndian.AppendUint16(data, 16)
+	data = append(data, "data"...)
+	data = binary.LittleEndian.AppendUint32(data, uint32(frames*4))
+	for i := range frames {
+		v := uint16(int16(16000 * math.Sin(2*math.Pi*440*float64(i)/float64(rate))))
+		data = binary.LittleEndian.AppendUint16(data, v)
+		data = binary.LittleEndian.AppendUint16(data, v)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type logEvent struct {
+	offset float64
+	event  string
+}
+
+func readEvents(t *testing.T, path string) []logEvent {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var events []logEvent
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		if line == "" {
+			continue
+		}
+		fields := strings.SplitN(line, "\t", 3)
+		if len(fields) != 3 {
+			t.Fatalf("malformed log line %q", line)
+		}
+		if _, err := time.Parse(time.RFC3339Nano, fields[0]); err != nil {
+			t.Fatalf("bad time in %q: %v", line, err)
+		}
+		offset, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			t.Fatalf("bad offset in %q: %v", line, err)
+		}
+		events = append(events, logEvent{offset: offset, event: fields[2]})
+	}
+	return events
+}
+
+func waitForEvent(t *testing.T, path, event string, count int) []logEvent {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, err := os.Stat(path); err == nil {
+			events := readEvents(t, path)
+			n := 0
+			for _, e := range events {
+				if e.event == event {
+					n++
+				}
+			}
+			if n >= count {
+				return events
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("no %q event in %s", event, path)
+	return nil
+}
+
+func TestPlayerFileOutput(t *testing.T) {
+	library := t.TempDir()
+	writeTone(t, filepath.Join(library, "tone.wav"), 44100, 3*time.Second)
+	recording := filepath.Join(t.TempDir(), "out.wav")
+	out, err := newOutput(OutputConfig{Type: "file", Path: recording, Buffer: "20ms"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := newAudioPlayer(library, "", out)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go p.run(ctx)
+
+	select {
+	case name := <-p.fileStarted():
+		if name != "tone.wav" {
+			t.Errorf("started %q, want tone.wav", name)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("playback did not start")
+	}
+	logPath := filepath.Join(filepath.Dir(recording), "out.log")
+	waitForEvent(t, logPath, "sound", 1)
+	time.Sleep(200 * time.Millisecond)
+	p.setPaused(true, true)
+	waitForEvent(t, logPath, "silence", 1)
+	time.Sleep(200 * time.Millisecond)
+	p.setPaused(false, true)
+	events := waitForEvent(t, logPath, "sound", 2)
+
+	var got []string
+	for _, e := range events {
+		got = append(got, e.event)
+	}
+	want := []string{"play tone.wav", "sound", "silence", "sound"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Fatalf("events = %q, want %q", got, want)
+	}
+	if events[1].offset >= events[2].offset || events[2].offset >= events[3].offset {
+		t.Errorf("offsets do not increase: %v", events)
+	}
+
+	f, err := os.Open(recording)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	header := make([]byte, 44)
+	if _, err := f.ReadAt(header, 0); err != nil {
+		t.Fatal(err)
+	}
+	info, _ := f.Stat()
+	if string(header[:4]) != "RIFF" || string(header[36:40]) != "data" {
+		t.Fatalf("not a WAV header: %q", header)
+	}
+	if size := binary.LittleEndian.Uint32(header[40:]); size == 0 || int64(size) > info.Size()-44 {
+		t.Errorf("data size %d does not match file size %d", size, info.Size())
+	}
+}
+
+func TestWAVSinkRotates(t *testing.T) {
+	dir := t.TempDir()
+	sink := &wavSink{path: filepath.Join(dir, "out.wav"), maxFrames: 100}
+	if err := sink.open(44100); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([][2]float64, 60)
+	for i := range buf {
+		buf[i] = [2]float64{0.5, -0.5}
+	}
+	for range 4 {
+		if err := sink.write(buf); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for name, frames := range map[string]uint32{"out.wav": 100, "out.1.wav": 100, "out.2.wav": 40} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := binary.LittleEndian.Uint32(data[40:]); got != frames*4 || len(data) != 44+int(frames)*4 {
+			t.Errorf("%s: data size %d, file size %d, want %d frames", name, got, len(data), frames)
+		}
+		if got := binary.LittleEndian.Uint32(data[4:]); got != 36+frames*4 {
+			t.Errorf("%s: RIFF size %d", name, got)
+		}
+	}
+	var rotations []logEvent
+	for _, e := range readEvents(t, filepath.Join(dir, "out.log")) {
+		if strings.HasPrefix(e.event, "file ") {
+			rotations = append(rotations, e)
+		}
+	}
+	if len(rotations) != 2 || rotations[0].event != "file out.1.wav" || rotations[1].event != "file out.2.wav" {
+		t.Fatalf("rotations = %v", rotations)
+	}
+	for i, e := range rotations {
+		if want := float64(100*(i+1)) / 44100; math.Abs(e.offset-want) > 0.001 {
+			t.Errorf("%s at %.3fs, want %.3fs", e.event, e.offset, want)
+		}
+	}
+}
+
+func TestParseALSADevice(t *testing.T) {
+	for _, tc := range []struct {
+		value, card, device string
+		err                 bool
+	}{
+		{value: ""},
+		{value: "default"},
+		{value: "1", card: "1"},
+		{value: "hw:1,0", card: "1", device: "0"},
+		{value: "1,3", card: "1", device: "3"},
+		{value: "Device", card: "Device"},
+		{value: "hw:USB_Audio", card: "USB_Audio"},
+		{value: "bluealsa", err: true},
+		{value: "bluealsa:DEV=4D:9E:51:18:AE:DE", err: true},
+		{value: "plughw:1,0", err: true},
+		{value: "dmix", err: true},
+		{value: "hw:CARD=Device,DEV=0", err: true},
+		{value: "hw:1,x", err: true},
+		{value: "hw:", err: true},
+	} {
+		card, device, err := parseALSADevice(tc.value)
+		if tc.err {
+			if err == nil {
+				t.Errorf("%q: expected an error, got card %q device %q", tc.value, card, device)
+			}
+			continue
+		}
+		if err != nil || card != tc.card || device != tc.device {
+			t.Errorf("%q = %q, %q, %v; want %q, %q", tc.value, card, device, err, tc.card, tc.device)
+		}
+	}
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var playlistExts = []string{".m3u", ".m3u8", ".pls"}
+
+// playlistAll selects every file in the audio folder instead of a playlist.
+const playlistAll = "all"
+
+type playlistEntry struct {
+	path   string
+	repeat int
+	gainDB float64
+	weight float64
+}
+
+func listPlaylists(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		if containsString(playlistExts, ext) {
+			names = append(names, strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name())))
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func findPlaylist(dir, name string) (string, error) {
+	// Names come from commands; keep them inside the folder.
+	if name == "" || strings.ContainsAny(name, `/\`) || strings.Contains(name, "..") {
+		return "", fmt.Errorf("invalid playlist name %q", name)
+	}
+	for _, ext := range playlistExts {
+		path := filepath.Join(dir, name+ext)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("playlist %q not found in %s", name, dir)
+}
+
+func loadPlaylist(dir, name string) ([]playlistEntry, error) {
+	path, err := findPlaylist(dir, name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []playlistEntry
+	if strings.EqualFold(filepath.Ext(path), ".pls") {
+		entries, err = parsePLS(bufio.NewScanner(f))
+	} else {
+		entries, err = parseM3U(bufio.NewScanner(f))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+
+	base := filepath.Dir(path)
+	resolved := entries[:0]
+	for _, entry := range entries {
+		if strings.Contains(entry.path, "://") {
+			continue
+		}
+		if isGenerator(entry.path) {
+			resolved = append(resolved, entry)
+			continue
+		}
+		entry.path = filepath.FromSlash(entry.path)
+		if !filepath.IsAbs(entry.path) {
+			entry.path = filepath.Join(base, entry.path)
+		}
+		resolved = append(resolved, entry)
+	}
+	if len(resolved) == 0 {
+		return nil, fmt.Errorf("%s: no playable entries", filepath.Base(path))
+	}
+	return resolved, nil
+}
+
+// parseM3U reads plain and extended M3U. Per-entry options are given on a
+// "#AFN:" line before the entry, e.g. "#AFN:repeat=3,gain=-6,weight=2".
+func parseM3U(scanner *bufio.Scanner) ([]playlistEntry, error) {
+	var entries []playlistEntry
+	pending := playlistEntry{repeat: 1}
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(strings.TrimPrefix(scanner.Text(), "\ufeff"))
+		switch {
+		case text == "":
+			continue
+		case strings.HasPrefix(text, "#AFN:"):
+			if err := parseEntryOptions(&pending, strings.TrimPrefix(text, "#AFN:")); err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+		case strings.HasPrefix(text, "#"):
+			continue
+		default:
+			pending.path = text
+			entries = append(entries, pending)
+			pending = playlistEntry{repeat: 1}
+		}
+	}
+	return entries, scanner.Err()
+}
+
+func parseEntryOptions(entry *playlistEntry, options string) error {
+	for _, option := range strings.Split(options, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(option), "=")
+		if !ok {
+			return fmt.Errorf("invalid option %q", option)
+		}
+		if err := setEntryOption(entry, strings.ToLower(key), value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func setEntryOption(entry *playlistEntry, key, value string) error {
+	value = strings.TrimSpace(value)
+	switch key {
+	case "repeat":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid repeat %q", value)
+		}
+		entry.repeat = n
+	case "gain":
+		db, err := strconv.ParseFloat(strings.TrimSuffix(strings.ToLower(value), "db"), 64)
+		if err != nil {
+			return fmt.Errorf("invalid gain %q", value)
+		}
+		entry.gainDB = db
+	case "weight":
+		w, err := strconv.ParseFloat(value, 64)
+		if err != nil || w <= 0 {
+			return fmt.Errorf("invalid weight %q", value)
+		}
+		entry.weight = w
+	default:
+		return fmt.Errorf("unknown option %q", key)
+	}
+	return nil
+}
+
+// parsePLS reads FileN= entries; RepeatN=, GainN= and WeightN= set the
+// per-entry options.
+func parsePLS(scanner *bufio.Scanner) ([]playlistEntry, error) {
+	byIndex := make(map[int]*playlistEntry)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(strings.TrimPrefix(scanner.Text(), "\ufeff"))
+		if text == "" || strings.HasPrefix(text, "[") || strings.HasPrefix(text, ";") {
+			continue
+		}
+		key, value, ok := strings.Cut(text, "=")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		var field string
+		for _, prefix := range []string{"file", "repeat", "gain", "weight"} {
+			if strings.HasPrefix(key, prefix) {
+				field = prefix
+				break
+			}
+		}
+		if field == "" {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimPrefix(key, field))
+		if err != nil {
+			continue
+		}
+		entry := byIndex[n]
+		if entry == nil {
+			entry = &playlistEntry{repeat: 1}
+			byIndex[n] = entry
+		}
+		if field == "file" {
+			entry.path = strings.TrimSpace(value)
+			continue
+		}
+		if err := setEntryOption(entry, field, value); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	indexes := make([]int, 0, len(byIndex))
+	for n := range byIndex {
+		indexes = append(indexes, n)
+	}
+	sort.Ints(indexes)
+	var entries []playlistEntry
+	for _, n := range indexes {
+		if byIndex[n].path != "" {
+			entries = append(entries, *byIndex[n])
+		}
+	}
+	return entries, nil
+}
+
+func libraryEntries(files []string) []playlistEntry {
+	entries := make([]playlistEntry, len(files))
+	for i, file := range files {
+		entries[i] = playlistEntry{path: file, repeat: 1}
+	}
+	return entries
+}
+
+// sequencer picks the next entry of the active list in the current mode,
+// honouring per-entry repeat counts. The library list is followed by file
+// path so that files added or reordered in between keep their place.
+type sequencer struct {
+	source   string
+	index    int
+	plays    int
+	lastPath string
+	played   map[string]int
+}
+
+func (s *sequencer) next(source string, mode playbackMode, entries []playlistEntry) playlistEntry {
+	if source != s.source {
+		s.source = source
+		s.index = -1
+		s.plays = 0
+		clear(s.played)
+	}
+	if s.played == nil {
+		s.played = make(map[string]int)
+	}
+	if source == "" {
+		s.index = -1
+		for i, entry := range entries {
+			if entry.path == s.lastPath {
+				s.index = i
+				break
+			}
+		}
+	}
+
+	valid := s.index >= 0 && s.index < len(entries) && entries[s.index].path == s.lastPath
+	if !valid || s.plays >= entries[s.index].repeat {
+		switch mode {
+		case modeShuffle:
+			s.index = s.pickShuffle(entries)
+		case modeWeighted:
+			s.index = s.pickWeighted(entries)
+		default:
+			s.index = (s.index + 1) % len(entries)
+		}
+		s.plays = 0
+	}
+	s.plays++
+	s.lastPath = entries[s.index].path
+	return entries[s.index]
+}
+
+func (s *sequencer) clone() sequencer {
+	c := *s
+	c.played = maps.Clone(s.played)
+	return c
+}
+
+func (s *sequencer) resume(source string, entries []playlistEntry, name string) (playlistEntry, bool) {
+	for i, entry := range entries {
+		if filepath.Base(entry.path) == name {
+			if source != s.source {
+				s.source = source
+				clear(s.played)
+			}
+			s.index = i
+			s.plays = 1
+			s.lastPath = entry.path
+			if s.played == nil {
+				s.played = make(map[string]int)
+			}
+			s.played[entry.path]++
+			return entry, true
+		}
+	}
+	return playlistEntry{}, false
+}
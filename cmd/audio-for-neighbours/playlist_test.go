@@ -0,0 +1,33 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestSequencerResumeShuffle(t *testing.T) {
+	var entries []playlistEntry
+	for _, name := range []string{"a.mp3", "b.mp3", "c.mp3", "d.mp3"} {
+		entries = append(entries, playlistEntry{path: filepath.Join("/music", name), repeat: 1})
+	}
+	for range 20 {
+		var seq sequencer
+		entry, ok := seq.resume("", entries, "c.mp3")
+		if !ok || filepath.Base(entry.path) != "c.mp3" {
+			t.Fatalf("resume = %v, %v", entry.path, ok)
+		}
+		seen := map[string]bool{"c.mp3": true}
+		for range len(entries) - 1 {
+			name := filepath.Base(seq.next("", modeShuffle, entries).path)
+			if seen[name] {
+				t.Fatalf("%s played twice in one round", name)
+			}
+			seen[name] = true
+		}
+	}
+
+	var seq sequencer
+	if _, ok := seq.resume("", entries, "gone.mp3"); ok {
+		t.Error("resumed a file that is not in the list")
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"io"
+	"math"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/faiface/beep"
+)
+
+type track struct {
+	path    string
+	file    io.Closer
+	decoder beep.StreamSeekCloser
+	format  beep.Format
+	stream  beep.Streamer
+	ratio   float64
+	gen     int
+	seq     sequencer
+}
+
+func (t *track) name() string {
+	return filepath.Base(t.path)
+}
+
+// remaining estimates the samples left at the output sample rate.
+func (t *track) remaining() int {
+	return int(float64(t.decoder.Len()-t.decoder.Position()) * t.ratio)
+}
+
+func (t *track) position() time.Duration {
+	return t.format.SampleRate.D(t.decoder.Position())
+}
+
+func (t *track) close() {
+	_ = t.decoder.Close()
+	if t.file != nil {
+		_ = t.file.Close()
+	}
+}
+
+// trackQueue is the single streamer handed to the speaker. It plays the
+// current track and mixes in the prefetched next one over the last
+// crossfade samples, so there is no gap at track boundaries.
+type trackQueue struct {
+	mu        sync.Mutex
+	current   *track
+	next      *track
+	crossfade int
+	mixBuf    [][2]float64
+	space     chan struct{}
+	onStart   func(*track)
+	gen       int
+	rewind    *sequencer
+}
+
+func newTrackQueue(onStart func(*track)) *trackQueue {
+	return &trackQueue{
+		space:   make(chan struct{}, 1),
+		onStart: onStart,
+	}
+}
+
+func (q *trackQueue) setCrossfade(samples int) {
+	q.mu.Lock()
+	q.crossfade = samples
+	q.mu.Unlock()
+}
+
+// flush drops the prefetched track and any track waiting in push, so the
+// next one is chosen again from the current file list. The current track
+// keeps playing.
+func (q *trackQueue) flush() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.gen++
+	if q.next != nil {
+		go q.next.close()
+		q.next = nil
+	}
+	if q.current != nil {
+		seq := q.current.seq.clone()
+		q.rewind = &seq
+	}
+	select {
+	case q.space <- struct{}{}:
+	default:
+	}
+}
+
+// takeRewind returns the current generation and, once after each flush,
+// the sequencer state right after the current track was chosen.
+func (q *trackQueue) takeRewind() (int, *sequencer) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	seq := q.rewind
+	q.rewind = nil
+	return q.gen, seq
+}
+
+// push hands over the next track and blocks while another one is already
+// waiting, which keeps exactly one track prefetched. A track from before a
+// flush is closed instead.
+func (q *trackQueue) push(ctx context.Context, t *track) bool {
+	for {
+		q.mu.Lock()
+		switch {
+		case t.gen != q.gen:
+			q.mu.Unlock()
+			t.close()
+			return true
+		case q.current == nil && q.next == nil:
+			q.current = t
+			q.mu.Unlock()
+			q.onStart(t)
+			return true
+		case q.next == nil:
+			q.next = t
+			q.mu.Unlock()
+			return true
+		}
+		q.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			t.close()
+			return false
+		case <-q.space:
+		}
+	}
+}
+
+func (q *trackQueue) skip() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.current != nil {
+		q.finishLocked()
+		q.advanceLocked()
+	}
+}
+
+func (q *trackQueue) progress() (string, time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.current == nil {
+		return "", 0
+	}
+	return q.current.name(), q.current.position()
+}
+
+func (q *trackQueue) Stream(samples [][2]float64) (int, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	filled := 0
+	for filled < len(samples) {
+		if q.current == nil && !q.advanceLocked() {
+			clear(samples[filled:])
+			break
+		}
+		buf := samples[filled:]
+		if q.next != nil && q.crossfade > 0 {
+			rem := q.current.remaining()
+			if rem <= q.crossfade {
+				filled += q.mixLocked(buf, rem)
+				continue
+			}
+			if lead := rem - q.crossfade; len(buf) > lead {
+				buf = buf[:lead]
+			}
+		}
+		n, ok := q.current.stream.Stream(buf)
+		filled += n
+		if !ok || n == 0 {
+			q.finishLocked()
+		}
+	}
+	return len(samples), true
+}
+
+func (q *trackQueue) mixLocked(buf [][2]float64, rem int) int {
+	if rem <= 0 {
+		q.finishLocked()
+		return 0
+	}
+	if len(buf) > rem {
+		buf = buf[:rem]
+	}
+	n, ok := q.current.stream.Stream(buf)
+	if n == 0 {
+		q.finishLocked()
+		return 0
+	}
+	if cap(q.mixBuf) < n {
+		q.mixBuf = make([][2]float64, n)
+	}
+	mix := q.mixBuf[:n]
+	m, _ := q.next.stream.Stream(mix)
+	clear(mix[m:])
+
+	for i := range n {
+		// Equal-power curves keep the loudness steady through the fade.
+		x := math.Max(0, math.Min(1, float64(rem-i)/float64(q.crossfade)))
+		out, in := math.Sin(x*math.Pi/2), math.Cos(x*math.Pi/2)
+		buf[i][0] = buf[i][0]*out + mix[i][0]*in
+		buf[i][1] = buf[i][1]*out + mix[i][1]*in
+	}
+	if !ok || n < len(buf) {
+		q.finishLocked()
+	}
+	return n
+}
+
+func (q *trackQueue) finishLocked() {
+	t := q.current
+	q.current = nil
+	go t.close()
+}
+
+func (q *trackQueue) advanceLocked() bool {
+	if q.next == nil {
+		return false
+	}
+	q.current = q.next
+	q.next = nil
+	select {
+	case q.space <- struct{}{}:
+	default:
+	}
+	q.onStart(q.current)
+	return true
+}
+
+func (q *trackQueue) Err() error {
+	return nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+type role int
+
+const (
+	roleNone role = iota
+	roleViewer
+	roleOperator
+	roleAdmin
+)
+
+const (
+	eventState    = "state"
+	eventFile     = "file"
+	eventPresence = "presence"
+	eventMotion   = "motion"
+)
+
+var allEventKinds = []string{eventState, eventFile, eventPresence, eventMotion}
+
+func parseRole(value string) (role, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "viewer", "":
+		return roleViewer, nil
+	case "operator":
+		return roleOperator, nil
+	case "admin":
+		return roleAdmin, nil
+	default:
+		return roleNone, fmt.Errorf("invalid role %q (want viewer, operator or admin)", value)
+	}
+}
+
+func (r role) String() string {
+	switch r {
+	case roleViewer:
+		return "viewer"
+	case roleOperator:
+		return "operator"
+	case roleAdmin:
+		return "admin"
+	default:
+		return "none"
+	}
+}
+
+func parseEventKinds(values []string) (map[string]bool, error) {
+	kinds := make(map[string]bool)
+	if len(values) == 0 {
+		values = allEventKinds
+	}
+	for _, value := range values {
+		kind := strings.ToLower(strings.TrimSpace(value))
+		if kind == "all" {
+			for _, k := range allEventKinds {
+				kinds[k] = true
+			}
+			continue
+		}
+		if !containsString(allEventKinds, kind) {
+			return nil, fmt.Errorf("invalid event %q (want one of %s)", value, strings.Join(allEventKinds, ", "))
+		}
+		kinds[kind] = true
+	}
+	return kinds, nil
+}
+
+// commandRole returns the role needed to run cmd with args. Settings
+// commands without arguments only show the current value.
+func commandRole(cmd, args string) role {
+	switch cmd {
+	case "volume", "vol", "playlist", "playlists", "mode", "dsp", "eq":
+		if strings.TrimSpace(args) == "" {
+			return roleViewer
+		}
+		return roleOperator
+	case "play", "start", "enable", "pause", "stop", "disable", "auto", "skip", "next", "upload":
+		return roleOperator
+	case "schedule", "reload":
+		return roleAdmin
+	default:
+		return roleViewer
+	}
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
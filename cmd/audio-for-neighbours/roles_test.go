@@ -0,0 +1,27 @@
+package main
+
+import "testing"
+
+func TestCommandRole(t *testing.T) {
+	for _, tc := range []struct {
+		cmd, args string
+		want      role
+	}{
+		{"status", "", roleViewer},
+		{"volume", "", roleViewer},
+		{"vol", "  ", roleViewer},
+		{"volume", "40", roleOperator},
+		{"playlist", "", roleViewer},
+		{"playlist", "auto", roleOperator},
+		{"mode", "", roleViewer},
+		{"mode", "shuffle", roleOperator},
+		{"dsp", "off", roleOperator},
+		{"pause", "", roleOperator},
+		{"skip", "", roleOperator},
+		{"reload", "", roleAdmin},
+	} {
+		if got := commandRole(tc.cmd, tc.args); got != tc.want {
+			t.Errorf("/%s %q requires %s, want %s", tc.cmd, tc.args, got, tc.want)
+		}
+	}
+}
@@ -41,6 +41,7 @@ func newRouterClient(base, username, password, lang string) *routerClient {
 func (r *routerClient) fetchOnlineTargets(ctx context.Context, targets []string) ([]string, error) {
 	if r.cookie == "" {
 		if err := r.login(ctx); err != nil {
+			metricRouterLoginFailures.Inc()
 			return nil, err
 		}
 	}
@@ -49,6 +50,7 @@ func (r *routerClient) fetchOnlineTargets(ctx context.Context, targets []string)
 	if err != nil {
 		r.cookie = ""
 		if err := r.login(ctx); err != nil {
+			metricRouterLoginFailures.Inc()
 			return nil, err
 		}
 		devices, err = r.fetchUserDevices(ctx)
@@ -221,6 +223,7 @@ func pollPresence(ctx context.Context, client *routerClient, targets []string, o
 		case <-ticker.C:
 			online, err := client.fetchOnlineTargets(ctx, targets)
 			if err != nil {
+				metricPresenceErrors.Inc()
 				logPresenceError(err)
 				continue
 			}
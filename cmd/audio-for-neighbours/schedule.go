@@ -0,0 +1,414 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type ScheduleConfig struct {
+	Timezone string                       `yaml:"timezone"`
+	Days     map[string]ScheduleDayConfig `yaml:"days"`
+	Holidays []string                     `yaml:"holidays"`
+}
+
+type ScheduleDayConfig struct {
+	Quiet     []string          `yaml:"quiet"`
+	Volume    map[string]int    `yaml:"volume"`
+	Playlists map[string]string `yaml:"playlists"`
+}
+
+type timeWindow struct {
+	start int
+	end   int
+}
+
+type volumeWindow struct {
+	timeWindow
+	level int
+}
+
+type playlistWindow struct {
+	timeWindow
+	name string
+}
+
+type scheduleDay struct {
+	quiet     []timeWindow
+	volume    []volumeWindow
+	playlists []playlistWindow
+}
+
+type weeklySchedule struct {
+	loc      *time.Location
+	days     [7]scheduleDay
+	holiday  scheduleDay
+	holidays map[string]bool
+}
+
+var defaultQuietWindows = []string{"22:00-09:00", "13:00-15:00"}
+
+var weekdayNames = map[string]time.Weekday{
+	"sunday":    time.Sunday,
+	"monday":    time.Monday,
+	"tuesday":   time.Tuesday,
+	"wednesday": time.Wednesday,
+	"thursday":  time.Thursday,
+	"friday":    time.Friday,
+	"saturday":  time.Saturday,
+}
+
+func parseSchedule(cfg ScheduleConfig) (*weeklySchedule, error) {
+	loc := time.Local
+	if cfg.Timezone != "" {
+		var err error
+		loc, err = time.LoadLocation(cfg.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule timezone: %w", err)
+		}
+	}
+
+	parsed := make(map[string]scheduleDay, len(cfg.Days))
+	for name, day := range cfg.Days {
+		key := strings.ToLower(strings.TrimSpace(name))
+		switch key {
+		case "default", "weekdays", "weekend", "holiday":
+		default:
+			if _, ok := weekdayNames[key]; !ok {
+				return nil, fmt.Errorf("unknown schedule day %q", name)
+			}
+		}
+		windows, err := parseWindows(day.Quiet)
+		if err != nil {
+			return nil, fmt.Errorf("schedule %s: %w", name, err)
+		}
+		volume, err := parseVolumeWindows(day.Volume)
+		if err != nil {
+			return nil, fmt.Errorf("schedule %s: %w", name, err)
+		}
+		playlists, err := parsePlaylistWindows(day.Playlists)
+		if err != nil {
+			return nil, fmt.Errorf("schedule %s: %w", name, err)
+		}
+		parsed[key] = scheduleDay{quiet: windows, volume: volume, playlists: playlists}
+	}
+
+	if _, ok := parsed["default"]; !ok {
+		windows, _ := parseWindows(defaultQuietWindows)
+		parsed["default"] = scheduleDay{quiet: windows}
+	}
+
+	s := &weeklySchedule{loc: loc, holidays: make(map[string]bool)}
+	for name, wd := range weekdayNames {
+		group := "weekdays"
+		if wd == time.Saturday || wd == time.Sunday {
+			group = "weekend"
+		}
+		s.days[wd] = firstDay(parsed, name, group, "default")
+	}
+	s.holiday = firstDay(parsed, "holiday", "sunday", "weekend", "default")
+
+	for _, date := range cfg.Holidays {
+		d, err := time.ParseInLocation("2006-01-02", strings.TrimSpace(date), loc)
+		if err != nil {
+			return nil, fmt.Errorf("invalid holiday %q: %w", date, err)
+		}
+		s.holidays[d.Format("2006-01-02")] = true
+	}
+	return s, nil
+}
+
+func firstDay(days map[string]scheduleDay, keys ...string) scheduleDay {
+	for _, key := range keys {
+		if day, ok := days[key]; ok {
+			return day
+		}
+	}
+	return scheduleDay{}
+}
+
+func parseWindows(values []string) ([]timeWindow, error) {
+	var windows []timeWindow
+	for _, value := range values {
+		w, err := parseWindow(value)
+		if err != nil {
+			return nil, err
+		}
+		windows = append(windows, w)
+	}
+	return windows, nil
+}
+
+func parseVolumeWindows(values map[string]int) ([]volumeWindow, error) {
+	var windows []volumeWindow
+	for value, level := range values {
+		w, err := parseWindow(value)
+		if err != nil {
+			return nil, err
+		}
+		if level < 0 || level > 100 {
+			return nil, fmt.Errorf("volume for %s must be 0-100, got %d", value, level)
+		}
+		windows = append(windows, volumeWindow{timeWindow: w, level: level})
+	}
+	sort.Slice(windows, func(i, j int) bool { return windows[i].start < windows[j].start })
+	return windows, nil
+}
+
+func parsePlaylistWindows(values map[string]string) ([]playlistWindow, error) {
+	var windows []playlistWindow
+	for value, name := range values {
+		w, err := parseWindow(value)
+		if err != nil {
+			return nil, err
+		}
+		if strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("empty playlist name for %s", value)
+		}
+		windows = append(windows, playlistWindow{timeWindow: w, name: strings.TrimSpace(name)})
+	}
+	sort.Slice(windows, func(i, j int) bool { return windows[i].start < windows[j].start })
+	return windows, nil
+}
+
+func parseWindow(value string) (timeWindow, error) {
+	parts := strings.Split(value, "-")
+	if len(parts) != 2 {
+		return timeWindow{}, fmt.Errorf("invalid window %q, expected HH:MM-HH:MM", value)
+	}
+	start, err := parseClock(parts[0])
+	if err != nil {
+		return timeWindow{}, err
+	}
+	end, err := parseClock(parts[1])
+	if err != nil {
+		return timeWindow{}, err
+	}
+	if start == end || start == minutesPerDay {
+		return timeWindow{}, fmt.Errorf("invalid window %q", value)
+	}
+	return timeWindow{start: start, end: end}, nil
+}
+
+func (w timeWindow) overnight() bool {
+	return w.end < w.start
+}
+
+func (w timeWindow) containsToday(m int) bool {
+	if w.overnight() {
+		return m >= w.start
+	}
+	return m >= w.start && m < w.end
+}
+
+func (w timeWindow) containsTomorrow(m int) bool {
+	return w.overnight() && m < w.end
+}
+
+func (w timeWindow) String() string {
+	return fmt.Sprintf("%02d:%02d-%02d:%02d", w.start/60, w.start%60, w.end/60, w.end%60)
+}
+
+func (s *weeklySchedule) dayRules(day time.Time) scheduleDay {
+	if s.holidays[day.Format("2006-01-02")] {
+		return s.holiday
+	}
+	return s.days[day.Weekday()]
+}
+
+func (s *weeklySchedule) isQuiet(t time.Time) bool {
+	t = t.In(s.loc)
+	today := startOfDay(t)
+	m := minuteOfDay(t)
+	for _, w := range s.dayRules(today).quiet {
+		if w.containsToday(m) {
+			return true
+		}
+	}
+	for _, w := range s.dayRules(today.AddDate(0, 0, -1)).quiet {
+		if w.containsTomorrow(m) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *weeklySchedule) volumeLimit(t time.Time) (int, bool) {
+	t = t.In(s.loc)
+	today := startOfDay(t)
+	m := minuteOfDay(t)
+	limit, ok := 100, false
+	for _, w := range s.dayRules(today).volume {
+		if w.containsToday(m) && w.level <= limit {
+			limit, ok = w.level, true
+		}
+	}
+	for _, w := range s.dayRules(today.AddDate(0, 0, -1)).volume {
+		if w.containsTomorrow(m) && w.level <= limit {
+			limit, ok = w.level, true
+		}
+	}
+	return limit, ok
+}
+
+func (s *weeklySchedule) playlistAt(t time.Time) string {
+	t = t.In(s.loc)
+	today := startOfDay(t)
+	m := minuteOfDay(t)
+	for _, w := range s.dayRules(today).playlists {
+		if w.containsToday(m) {
+			return w.name
+		}
+	}
+	for _, w := range s.dayRules(today.AddDate(0, 0, -1)).playlists {
+		if w.containsTomorrow(m) {
+			return w.name
+		}
+	}
+	return ""
+}
+
+func (s *weeklySchedule) boundaries(from, until time.Time) []time.Time {
+	var out []time.Time
+	day := startOfDay(from.In(s.loc)).AddDate(0, 0, -1)
+	for !day.After(until) {
+		for _, w := range s.dayRules(day).quiet {
+			end := atMinute(day, w.end)
+			if w.overnight() {
+				end = atMinute(day.AddDate(0, 0, 1), w.end)
+			}
+			for _, b := range []time.Time{atMinute(day, w.start), end} {
+				if b.After(from) && !b.After(until) {
+					out = append(out, b)
+				}
+			}
+		}
+		day = day.AddDate(0, 0, 1)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Before(out[j]) })
+	return out
+}
+
+type scheduler struct {
+	mu        sync.Mutex
+	weekly    *weeklySchedule
+	calendars *calendarSet
+}
+
+func newScheduler(weekly *weeklySchedule, calendars []CalendarConfig) *scheduler {
+	s := &scheduler{}
+	s.replace(weekly, calendars)
+	return s
+}
+
+func (s *scheduler) replace(weekly *weeklySchedule, calendars []CalendarConfig) {
+	set := newCalendarSet(calendars, weekly.loc)
+	s.mu.Lock()
+	s.weekly = weekly
+	s.calendars = set
+	s.mu.Unlock()
+}
+
+func (s *scheduler) current() (*weeklySchedule, *calendarSet) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.weekly, s.calendars
+}
+
+func (s *scheduler) location() *time.Location {
+	weekly, _ := s.current()
+	return weekly.loc
+}
+
+func (s *scheduler) reload() {
+	_, calendars := s.current()
+	calendars.reload()
+}
+
+func (s *scheduler) state(t time.Time) (bool, string) {
+	weekly, calendars := s.current()
+	var quiet, play []calendarOccurrence
+	for _, occ := range calendars.activeAt(t) {
+		if occ.mode == calendarModePlay {
+			play = append(play, occ)
+		} else {
+			quiet = append(quiet, occ)
+		}
+	}
+	if len(play) > 0 {
+		return false, "calendar play: " + describeOccurrences(play)
+	}
+	if len(quiet) > 0 {
+		return true, "calendar: " + describeOccurrences(quiet)
+	}
+	if weekly.isQuiet(t) {
+		return true, "quiet hours"
+	}
+	return false, "schedule"
+}
+
+func (s *scheduler) volumeLimit(t time.Time) int {
+	weekly, _ := s.current()
+	limit, _ := weekly.volumeLimit(t)
+	return limit
+}
+
+func (s *scheduler) playlist(t time.Time) string {
+	weekly, _ := s.current()
+	return weekly.playlistAt(t)
+}
+
+func (s *scheduler) nextTransition(now time.Time) (time.Time, bool, bool) {
+	weekly, calendars := s.current()
+	until := now.AddDate(0, 0, 8)
+	candidates := append(weekly.boundaries(now, until), calendars.boundaries(now, until)...)
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].Before(candidates[j]) })
+
+	current, _ := s.state(now)
+	for _, b := range candidates {
+		if quiet, _ := s.state(b); quiet != current {
+			return b, quiet, true
+		}
+	}
+	return time.Time{}, current, false
+}
+
+func (s *scheduler) describe(now time.Time) string {
+	weekly, calendars := s.current()
+	lines := []string{"Time zone: " + weekly.loc.String()}
+	day := startOfDay(now.In(weekly.loc))
+	for i := 0; i < 7; i++ {
+		d := day.AddDate(0, 0, i)
+		var windows []string
+		for _, w := range weekly.dayRules(d).quiet {
+			windows = append(windows, w.String())
+		}
+		if len(windows) == 0 {
+			windows = append(windows, "none")
+		}
+		label := d.Format("Mon 02 Jan")
+		if weekly.holidays[d.Format("2006-01-02")] {
+			label += " (holiday)"
+		}
+		line := fmt.Sprintf("%s: quiet %s", label, strings.Join(windows, ", "))
+		var volume []string
+		for _, w := range weekly.dayRules(d).volume {
+			volume = append(volume, fmt.Sprintf("%s %d%%", w.timeWindow, w.level))
+		}
+		if len(volume) > 0 {
+			line += "; volume " + strings.Join(volume, ", ")
+		}
+		var playlists []string
+		for _, w := range weekly.dayRules(d).playlists {
+			playlists = append(playlists, fmt.Sprintf("%s %s", w.timeWindow, w.name))
+		}
+		if len(playlists) > 0 {
+			line += "; playlists " + strings.Join(playlists, ", ")
+		}
+		lines = append(lines, line)
+	}
+	lines = append(lines, fmt.Sprintf("Calendars: %d file(s), %d event(s)", calendars.sourceCount(), calendars.eventCount()))
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func mustSchedule(t *testing.T, cfg ScheduleConfig) *weeklySchedule {
+	t.Helper()
+	s, err := parseSchedule(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestParseWindow(t *testing.T) {
+	for _, tc := range []struct {
+		value     string
+		want      string
+		overnight bool
+		err       bool
+	}{
+		{value: "13:00-15:00", want: "13:00-15:00"},
+		{value: "22:00-09:00", want: "22:00-09:00", overnight: true},
+		{value: " 7:30 - 8:15 ", want: "07:30-08:15"},
+		{value: "08:00-24:00", want: "08:00-24:00"},
+		{value: "24:00-08:00", err: true},
+		{value: "10:00-10:00", err: true},
+		{value: "10:00", err: true},
+		{value: "10:00-11:00-12:00", err: true},
+		{value: "25:00-01:00", err: true},
+		{value: "10:60-11:00", err: true},
+	} {
+		w, err := parseWindow(tc.value)
+		if tc.err {
+			if err == nil {
+				t.Errorf("%q: expected an error, got %s", tc.value, w)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tc.value, err)
+			continue
+		}
+		if w.String() != tc.want || w.overnight() != tc.overnight {
+			t.Errorf("%q = %s (overnight %v), want %s (overnight %v)", tc.value, w, w.overnight(), tc.want, tc.overnight)
+		}
+	}
+}
+
+func TestScheduleDayFallback(t *testing.T) {
+	day := func(window string) ScheduleDayConfig { return ScheduleDayConfig{Quiet: []string{window}} }
+	first := func(d scheduleDay) string {
+		if len(d.quiet) == 0 {
+			return "none"
+		}
+		return d.quiet[0].String()
+	}
+	for _, tc := range []struct {
+		name string
+		days map[string]ScheduleDayConfig
+		want map[time.Weekday]string
+		// holiday is the rule used on listed holidays.
+		holiday string
+	}{
+		{
+			name:    "built-in default",
+			want:    map[time.Weekday]string{time.Monday: "22:00-09:00", time.Sunday: "22:00-09:00"},
+			holiday: "22:00-09:00",
+		},
+		{
+			name: "weekday name before group before default",
+			days: map[string]ScheduleDayConfig{
+				"default":  day("20:00-08:00"),
+				"weekdays": day("21:00-07:00"),
+				"weekend":  day("23:00-10:00"),
+				"Friday":   day("23:30-07:00"),
+			},
+			want: map[time.Weekday]string{
+				time.Monday:   "21:00-07:00",
+				time.Friday:   "23:30-07:00",
+				time.Saturday: "23:00-10:00",
+				time.Sunday:   "23:00-10:00",
+			},
+			holiday: "23:00-10:00",
+		},
+		{
+			name: "groups fall back to default",
+			days: map[string]ScheduleDayConfig{
+				"default":  day("20:00-08:00"),
+				"saturday": day("00:00-11:00"),
+			},
+			want: map[time.Weekday]string{
+				time.Wednesday: "20:00-08:00",
+				time.Saturday:  "00:00-11:00",
+				time.Sunday:    "20:00-08:00",
+			},
+			holiday: "20:00-08:00",
+		},
+		{
+			name: "holiday uses sunday before weekend",
+			days: map[string]ScheduleDayConfig{
+				"weekend": day("23:00-10:00"),
+				"sunday":  day("22:00-11:00"),
+			},
+			want: map[time.Weekday]string{
+				time.Monday:   "22:00-09:00",
+				time.Saturday: "23:00-10:00",
+				time.Sunday:   "22:00-11:00",
+			},
+			holiday: "22:00-11:00",
+		},
+		{
+			name: "explicit holiday rules",
+			days: map[string]ScheduleDayConfig{
+				"sunday":  day("22:00-11:00"),
+				"holiday": day("12:00-16:00"),
+			},
+			want:    map[time.Weekday]string{time.Sunday: "22:00-11:00"},
+			holiday: "12:00-16:00",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := mustSchedule(t, ScheduleConfig{Timezone: "UTC", Days: tc.days})
+			for wd, want := range tc.want {
+				if got := first(s.days[wd]); got != want {
+					t.Errorf("%s: %s, want %s", wd, got, want)
+				}
+			}
+			if got := first(s.holiday); got != tc.holiday {
+				t.Errorf("holiday: %s, want %s", got, tc.holiday)
+			}
+		})
+	}
+
+	if _, err := parseSchedule(ScheduleConfig{Days: map[string]ScheduleDayConfig{"someday": day("10:00-11:00")}}); err == nil {
+		t.Error("expected an error for an unknown day")
+	}
+}
+
+func TestScheduleIsQuiet(t *testing.T) {
+	s := mustSchedule(t, ScheduleConfig{
+		Timezone: "Europe/Berlin",
+		Days: map[string]ScheduleDayConfig{
+			"default": {Quiet: []string{"22:00-06:00"}},
+			"weekend": {Quiet: []string{"23:00-08:00", "13:00-15:00"}},
+			"friday":  {Quiet: []string{"23:30-07:00"}},
+		},
+		// A Wednesday.
+		Holidays: []string{"2026-10-14"},
+	})
+	loc := s.loc
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2026, time.October, day, hour, minute, 0, 0, loc)
+	}
+	for _, tc := range []struct {
+		name  string
+		at    time.Time
+		quiet bool
+	}{
+		{"monday evening", at(12, 21, 59), false},
+		{"monday window starts", at(12, 22, 0), true},
+		{"overnight into tuesday", at(13, 5, 59), true},
+		{"overnight window ends", at(13, 6, 0), false},
+		{"tuesday night before the holiday", at(13, 23, 0), true},
+		{"tuesday window runs into the holiday", at(14, 5, 0), true},
+		{"holiday uses weekend rules", at(14, 14, 0), true},
+		{"holiday evening", at(14, 22, 30), false},
+		{"holiday night", at(14, 23, 0), true},
+		{"holiday window runs into thursday", at(15, 7, 30), true},
+		{"thursday morning", at(15, 8, 0), false},
+		{"friday overrides default", at(16, 22, 30), false},
+		{"friday window", at(16, 23, 45), true},
+		{"friday window runs into saturday", at(17, 6, 30), true},
+		{"saturday morning after friday window", at(17, 7, 30), false},
+		{"saturday afternoon", at(17, 14, 0), true},
+		{"saturday window runs into sunday", at(18, 7, 59), true},
+		{"sunday late morning", at(18, 8, 0), false},
+		{"sunday window runs into monday", at(19, 7, 0), true},
+		{"other time zone", time.Date(2026, time.October, 12, 20, 30, 0, 0, time.UTC), true},
+	} {
+		if got := s.isQuiet(tc.at); got != tc.quiet {
+			t.Errorf("%s (%s): quiet = %v, want %v", tc.name, tc.at.Format("Mon 15:04 MST"), got, tc.quiet)
+		}
+	}
+}
+
+func TestNextTransition(t *testing.T) {
+	weekly := mustSchedule(t, ScheduleConfig{
+		Timezone: "UTC",
+		Days: map[string]ScheduleDayConfig{
+			"default": {},
+			"sunday":  {Quiet: []string{"22:00-06:00"}},
+		},
+	})
+	s := newScheduler(weekly, nil)
+	at := func(day, hour int) time.Time {
+		return time.Date(2026, time.October, day, hour, 0, 0, 0, time.UTC)
+	}
+	for _, tc := range []struct {
+		name  string
+		now   time.Time
+		want  time.Time
+		quiet bool
+	}{
+		{"monday to the next sunday", at(12, 10), at(18, 22), true},
+		{"saturday to sunday", at(17, 23), at(18, 22), true},
+		{"sunday night across the week boundary", at(18, 23), at(19, 6), false},
+		{"exactly at a boundary", at(18, 22), at(19, 6), false},
+	} {
+		got, quiet, ok := s.nextTransition(tc.now)
+		if !ok || !got.Equal(tc.want) || quiet != tc.quiet {
+			t.Errorf("%s: got %s quiet=%v ok=%v, want %s quiet=%v", tc.name, got, quiet, ok, tc.want, tc.quiet)
+		}
+	}
+
+	empty := newScheduler(mustSchedule(t, ScheduleConfig{Timezone: "UTC", Days: map[string]ScheduleDayConfig{"default": {}}}), nil)
+	if _, quiet, ok := empty.nextTransition(at(12, 10)); ok || quiet {
+		t.Errorf("schedule without windows: ok=%v quiet=%v, want no transition", ok, quiet)
+	}
+}
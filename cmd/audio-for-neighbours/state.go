@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+const defaultStateFile = "state.json"
+
+type persistedState struct {
+	PausedByManual bool      `json:"paused_by_manual"`
+	ForcePlay      bool      `json:"force_play"`
+	OverrideUntil  time.Time `json:"override_until,omitzero"`
+	LastFile       string    `json:"last_file,omitempty"`
+	PositionMs     int64     `json:"position_ms,omitempty"`
+	Volume         *int      `json:"volume,omitempty"`
+	Playlist       string    `json:"playlist,omitempty"`
+	Mode           string    `json:"mode,omitempty"`
+	DSP            *string   `json:"dsp,omitempty"`
+}
+
+type stateStore struct {
+	path string
+
+	mu    sync.Mutex
+	state persistedState
+	last  []byte
+}
+
+func newStateStore(path string) *stateStore {
+	s := &stateStore{path: path}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Printf("state load error: %v", err)
+		}
+		return s
+	}
+	if err := json.Unmarshal(data, &s.state); err != nil {
+		log.Printf("state load error: %s: %v", path, err)
+		s.state = persistedState{}
+		return s
+	}
+	s.last = data
+	return s
+}
+
+func (s *stateStore) get() persistedState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state
+}
+
+func (s *stateStore) update(fn func(*persistedState)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	next := s.state
+	fn(&next)
+	data, err := json.MarshalIndent(next, "", "  ")
+	if err != nil {
+		log.Printf("state encode error: %v", err)
+		return
+	}
+	data = append(data, '\n')
+	s.state = next
+	if bytes.Equal(data, s.last) {
+		return
+	}
+	if err := writeFileAtomic(s.path, data); err != nil {
+		log.Printf("state save error: %v", err)
+		return
+	}
+	s.last = data
+}
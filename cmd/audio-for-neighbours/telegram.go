@@ -2,66 +2,452 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
-type telegramNotifier struct {
-	bot    *tgbotapi.BotAPI
+type commandRequest struct {
+	name   string
+	args   string
+	source string
 	chatID int64
+	role   role
+	data   []byte
+}
+
+type telegramChat struct {
+	id     int64
+	role   role
+	events map[string]bool
 }
 
-func newTelegramNotifier(token string, chatID int64) (*telegramNotifier, error) {
-	if token == "" || chatID == 0 {
+const telegramPollTimeout = 60
+
+type telegramNotifier struct {
+	bot   *tgbotapi.BotAPI
+	chats map[int64]*telegramChat
+	users map[int64]role
+
+	panelMu    sync.Mutex
+	panels     map[int64]int
+	panelQueue map[int64]bool
+	panelWake  chan struct{}
+}
+
+func newTelegramNotifier(cfg TelegramConfig) (*telegramNotifier, error) {
+	chats, users, err := parseTelegramAccess(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Token == "" || (len(chats) == 0 && len(users) == 0) {
 		return nil, nil
 	}
-	bot, err := tgbotapi.NewBotAPI(token)
+	// The client is shared by the long poll and the notifications, so it
+	// needs room for a full poll on top of a delivery.
+	client := &http.Client{Timeout: telegramPollTimeout*time.Second + notifierTimeout}
+	bot, err := tgbotapi.NewBotAPIWithClient(cfg.Token, tgbotapi.APIEndpoint, client)
 	if err != nil {
 		return nil, err
 	}
-	return &telegramNotifier{bot: bot, chatID: chatID}, nil
+	return &telegramNotifier{
+		bot:        bot,
+		chats:      chats,
+		users:      users,
+		panels:     make(map[int64]int),
+		panelQueue: make(map[int64]bool),
+		panelWake:  make(chan struct{}, 1),
+	}, nil
 }
 
-func (t *telegramNotifier) run(ctx context.Context, handler func(string) string) {
+func parseTelegramAccess(cfg TelegramConfig) (map[int64]*telegramChat, map[int64]role, error) {
+	chats := make(map[int64]*telegramChat)
+	if cfg.ChatID != 0 {
+		events, _ := parseEventKinds(nil)
+		chats[cfg.ChatID] = &telegramChat{id: cfg.ChatID, role: roleAdmin, events: events}
+	}
+	for _, c := range cfg.Chats {
+		if c.ID == 0 {
+			return nil, nil, fmt.Errorf("telegram chat id is empty")
+		}
+		r, err := parseRole(c.Role)
+		if err != nil {
+			return nil, nil, fmt.Errorf("telegram chat %d: %w", c.ID, err)
+		}
+		events, err := parseEventKinds(c.Events)
+		if err != nil {
+			return nil, nil, fmt.Errorf("telegram chat %d: %w", c.ID, err)
+		}
+		chats[c.ID] = &telegramChat{id: c.ID, role: r, events: events}
+	}
+
+	users := make(map[int64]role)
+	for _, u := range cfg.Users {
+		if u.ID == 0 {
+			return nil, nil, fmt.Errorf("telegram user id is empty")
+		}
+		r, err := parseRole(u.Role)
+		if err != nil {
+			return nil, nil, fmt.Errorf("telegram user %d: %w", u.ID, err)
+		}
+		users[u.ID] = r
+	}
+	return chats, users, nil
+}
+
+func (t *telegramNotifier) roleFor(chatID int64, from *tgbotapi.User) role {
+	r := roleNone
+	if chat, ok := t.chats[chatID]; ok {
+		r = chat.role
+	}
+	if from != nil {
+		if userRole, ok := t.users[from.ID]; ok && userRole > r {
+			r = userRole
+		}
+	}
+	return r
+}
+
+func (t *telegramNotifier) run(ctx context.Context, handler func(commandRequest) string, status func() string) {
 	u := tgbotapi.NewUpdate(0)
-	u.Timeout = 60
+	u.Timeout = telegramPollTimeout
 	updates := t.bot.GetUpdatesChan(u)
+	go t.runPanels(ctx, status)
 
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		case update := <-updates:
-			if update.Message == nil {
+			if update.CallbackQuery != nil {
+				t.handleCallback(update.CallbackQuery, handler, status)
+				continue
+			}
+			if update.Message == nil || update.Message.Chat == nil {
 				continue
 			}
-			if update.Message.Chat == nil || update.Message.Chat.ID != t.chatID {
+			chatID := update.Message.Chat.ID
+			r := t.roleFor(chatID, update.Message.From)
+			if r == roleNone {
 				continue
 			}
 			cmd := update.Message.Command()
 			if cmd == "" {
+				t.handleUpload(update.Message, r, handler)
 				continue
 			}
-			resp := handler(cmd)
-			t.send(resp)
+			args := strings.TrimSpace(update.Message.CommandArguments())
+			if need := commandRole(cmd, args); r < need {
+				t.send(chatID, fmt.Sprintf("/%s requires the %s role (you are %s).", cmd, need, r))
+				continue
+			}
+			resp := handler(commandRequest{
+				name:   cmd,
+				args:   args,
+				source: "telegram",
+				chatID: chatID,
+				role:   r,
+			})
+			if resp != "" {
+				t.send(chatID, resp)
+			}
+		}
+	}
+}
+
+// handleUpload passes audio files and voice messages to the handler as an
+// "upload" command. The caption, if any, names the file.
+func (t *telegramNotifier) handleUpload(msg *tgbotapi.Message, r role, handler func(commandRequest) string) {
+	var fileID, name string
+	var size int
+	switch {
+	case msg.Audio != nil:
+		fileID, name, size = msg.Audio.FileID, msg.Audio.FileName, msg.Audio.FileSize
+		if name == "" {
+			name = strings.TrimSpace(msg.Audio.Performer + " - " + msg.Audio.Title)
+		}
+	case msg.Voice != nil:
+		fileID, size = msg.Voice.FileID, msg.Voice.FileSize
+		name = "voice " + msg.Time().Format("2006-01-02 15-04-05") + ".ogg"
+	case msg.Document != nil:
+		doc := msg.Document
+		if !strings.HasPrefix(doc.MimeType, "audio/") && !containsString(uploadExts, strings.ToLower(filepath.Ext(doc.FileName))) {
+			return
+		}
+		fileID, name, size = doc.FileID, doc.FileName, doc.FileSize
+	default:
+		return
+	}
+	chatID := msg.Chat.ID
+	if need := commandRole("upload", ""); r < need {
+		t.send(chatID, fmt.Sprintf("Uploading requires the %s role (you are %s).", need, r))
+		return
+	}
+	if size > maxUploadSize {
+		t.send(chatID, fmt.Sprintf("File is too large (%d MB, at most %d MB).", size>>20, maxUploadSize>>20))
+		return
+	}
+	if caption := strings.TrimSpace(msg.Caption); caption != "" {
+		name = caption
+	}
+
+	// Downloading and converting can take minutes; other updates, such as a
+	// /pause, must not wait for it.
+	go func() {
+		data, err := t.download(fileID)
+		if err != nil {
+			t.send(chatID, fmt.Sprintf("Download failed: %v", err))
+			return
+		}
+		resp := handler(commandRequest{
+			name:   "upload",
+			args:   name,
+			source: "telegram",
+			chatID: chatID,
+			role:   r,
+			data:   data,
+		})
+		if resp != "" {
+			t.send(chatID, resp)
+		}
+	}()
+}
+
+func (t *telegramNotifier) download(fileID string) ([]byte, error) {
+	url, err := t.bot.GetFileDirectURL(fileID)
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{Timeout: 2 * time.Minute}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("download: %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxUploadSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxUploadSize {
+		return nil, fmt.Errorf("file is larger than %d MB", maxUploadSize>>20)
+	}
+	return data, nil
+}
+
+func (t *telegramNotifier) handleCallback(query *tgbotapi.CallbackQuery, handler func(commandRequest) string, status func() string) {
+	msg := query.Message
+	if msg == nil || msg.Chat == nil {
+		_, _ = t.bot.Request(tgbotapi.NewCallback(query.ID, ""))
+		return
+	}
+	chatID := msg.Chat.ID
+	r := t.roleFor(chatID, query.From)
+	if r == roleNone {
+		_, _ = t.bot.Request(tgbotapi.NewCallback(query.ID, ""))
+		return
+	}
+
+	resp := "Status refreshed."
+	switch {
+	case query.Data == "status":
+	case r < commandRole(query.Data, ""):
+		resp = fmt.Sprintf("Requires the %s role.", commandRole(query.Data, ""))
+	default:
+		resp = handler(commandRequest{name: query.Data, source: "telegram", chatID: chatID, role: r})
+	}
+	_, _ = t.bot.Request(tgbotapi.NewCallback(query.ID, resp))
+
+	t.panelMu.Lock()
+	t.panels[chatID] = msg.MessageID
+	t.panelMu.Unlock()
+	t.queuePanel(chatID, false)
+}
+
+func panelKeyboard() tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("▶ Play", "play"),
+			tgbotapi.NewInlineKeyboardButtonData("⏸ Pause", "pause"),
+			tgbotapi.NewInlineKeyboardButtonData("Auto", "auto"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("Snapshot", "snapshot"),
+			tgbotapi.NewInlineKeyboardButtonData("⏭ Skip", "skip"),
+			tgbotapi.NewInlineKeyboardButtonData("Refresh", "status"),
+		),
+	)
+}
+
+// showPanel posts a fresh control panel to the chat.
+func (t *telegramNotifier) showPanel(chatID int64) {
+	t.queuePanel(chatID, true)
+}
+
+// updatePanels refreshes the control panel in every chat that follows state
+// changes.
+func (t *telegramNotifier) updatePanels() {
+	for _, chat := range t.subscribers(eventState) {
+		t.queuePanel(chat, false)
+	}
+}
+
+// queuePanel marks the chat's panel as outdated without waiting for Telegram.
+// Requests pile up while an edit is in flight and are sent as one, with the
+// status at the time of sending.
+func (t *telegramNotifier) queuePanel(chatID int64, resend bool) {
+	if t == nil {
+		return
+	}
+	t.panelMu.Lock()
+	t.panelQueue[chatID] = t.panelQueue[chatID] || resend
+	t.panelMu.Unlock()
+	select {
+	case t.panelWake <- struct{}{}:
+	default:
+	}
+}
+
+func (t *telegramNotifier) runPanels(ctx context.Context, status func() string) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.panelWake:
+		}
+		t.panelMu.Lock()
+		queued := t.panelQueue
+		t.panelQueue = make(map[int64]bool)
+		t.panelMu.Unlock()
+
+		text := status()
+		for chatID, resend := range queued {
+			if resend {
+				t.sendPanel(chatID, text)
+			} else {
+				t.updatePanel(chatID, text)
+			}
+		}
+	}
+}
+
+func (t *telegramNotifier) sendPanel(chatID int64, text string) {
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ReplyMarkup = panelKeyboard()
+	sent, err := t.botSend(msg)
+	if err != nil {
+		log.Printf("telegram panel error: %v", err)
+		return
+	}
+	t.panelMu.Lock()
+	t.panels[chatID] = sent.MessageID
+	t.panelMu.Unlock()
+}
+
+func (t *telegramNotifier) updatePanel(chatID int64, text string) {
+	t.panelMu.Lock()
+	panelID := t.panels[chatID]
+	t.panelMu.Unlock()
+	if panelID == 0 {
+		t.sendPanel(chatID, text)
+		return
+	}
+
+	edit := tgbotapi.NewEditMessageTextAndMarkup(chatID, panelID, text, panelKeyboard())
+	if _, err := t.bot.Request(edit); err != nil {
+		if strings.Contains(err.Error(), "message is not modified") {
+			return
 		}
+		metricTelegramFailures.Inc()
+		log.Printf("telegram panel edit error: %v", err)
+		t.sendPanel(chatID, text)
 	}
 }
 
-func (t *telegramNotifier) send(msg string) {
+func (t *telegramNotifier) subscribers(kind string) []int64 {
+	if t == nil {
+		return nil
+	}
+	var ids []int64
+	for id, chat := range t.chats {
+		if chat.events[kind] {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func (t *telegramNotifier) Name() string {
+	return "telegram"
+}
+
+func (t *telegramNotifier) SendText(kind, text string) error {
+	// State changes are shown by editing the control panel instead.
+	if kind == eventState {
+		return nil
+	}
+	var firstErr error
+	for _, chat := range t.subscribers(kind) {
+		if _, err := t.botSend(tgbotapi.NewMessage(chat, text)); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (t *telegramNotifier) SendPhoto(kind, filename string, data []byte) error {
+	var firstErr error
+	for _, chat := range t.subscribers(kind) {
+		photo := tgbotapi.NewPhoto(chat, tgbotapi.FileBytes{Name: filename, Bytes: data})
+		if _, err := t.botSend(photo); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (t *telegramNotifier) SendVideo(kind, filename string, data []byte) error {
+	var firstErr error
+	for _, chat := range t.subscribers(kind) {
+		video := tgbotapi.NewVideo(chat, tgbotapi.FileBytes{Name: filename, Bytes: data})
+		if _, err := t.botSend(video); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (t *telegramNotifier) send(chatID int64, msg string) {
 	if t == nil {
 		return
 	}
-	_, _ = t.bot.Send(tgbotapi.NewMessage(t.chatID, msg))
+	_, _ = t.botSend(tgbotapi.NewMessage(chatID, msg))
 }
 
-func (t *telegramNotifier) sendPhotoBytes(filename string, data []byte) {
+func (t *telegramNotifier) sendPhotoBytes(chatID int64, filename string, data []byte) {
 	if t == nil {
 		return
 	}
-	photo := tgbotapi.NewPhoto(t.chatID, tgbotapi.FileBytes{
+	photo := tgbotapi.NewPhoto(chatID, tgbotapi.FileBytes{
 		Name:  filename,
 		Bytes: data,
 	})
-	_, _ = t.bot.Send(photo)
+	_, _ = t.botSend(photo)
+}
+
+func (t *telegramNotifier) botSend(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	msg, err := t.bot.Send(c)
+	if err != nil {
+		metricTelegramFailures.Inc()
+	}
+	return msg, err
 }
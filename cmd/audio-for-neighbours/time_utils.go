@@ -1,11 +1,83 @@
 package main
 
-import "time"
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
 
-func isQuietHours(t time.Time) bool {
-	hour := t.Hour()
-	if hour >= 22 || hour < 9 {
-		return true
+const minutesPerDay = 24 * 60
+
+func parseClock(value string) (int, error) {
+	parts := strings.Split(strings.TrimSpace(value), ":")
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", value)
+	}
+	hour, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q: %w", value, err)
+	}
+	minute, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q: %w", value, err)
+	}
+	if hour == 24 && minute == 0 {
+		return minutesPerDay, nil
+	}
+	if hour < 0 || hour > 23 || minute < 0 || minute > 59 {
+		return 0, fmt.Errorf("invalid time %q", value)
+	}
+	return hour*60 + minute, nil
+}
+
+func minuteOfDay(t time.Time) int {
+	return t.Hour()*60 + t.Minute()
+}
+
+func startOfDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+func atMinute(day time.Time, minute int) time.Time {
+	y, m, d := day.Date()
+	return time.Date(y, m, d, minute/60, minute%60, 0, 0, day.Location())
+}
+
+func formatTransition(t, now time.Time) string {
+	if startOfDay(t).Equal(startOfDay(now.In(t.Location()))) {
+		return t.Format("15:04")
+	}
+	return t.Format("Mon 15:04")
+}
+
+func parseOverrideUntil(args string, now time.Time, loc *time.Location) (time.Time, error) {
+	value := strings.ToLower(strings.TrimSpace(args))
+	if value == "" {
+		return time.Time{}, nil
+	}
+	value = strings.TrimSpace(strings.TrimPrefix(strings.TrimPrefix(value, "until"), "for"))
+
+	if strings.Contains(value, ":") {
+		minute, err := parseClock(value)
+		if err != nil {
+			return time.Time{}, err
+		}
+		local := now.In(loc)
+		until := atMinute(startOfDay(local), minute)
+		if !until.After(local) {
+			until = atMinute(startOfDay(local).AddDate(0, 0, 1), minute)
+		}
+		return until, nil
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid duration or time %q", args)
+	}
+	if d <= 0 {
+		return time.Time{}, fmt.Errorf("duration must be positive")
 	}
-	return hour >= 13 && hour < 15
+	return now.Add(d), nil
 }
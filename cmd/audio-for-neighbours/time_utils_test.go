@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseOverrideUntil(t *testing.T) {
+	berlin := mustLocation(t, "Europe/Berlin")
+	// 14:30 in Berlin.
+	now := time.Date(2026, time.October, 16, 12, 30, 0, 0, time.UTC)
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2026, time.October, day, hour, minute, 0, 0, berlin)
+	}
+	for _, tc := range []struct {
+		args string
+		want time.Time
+		err  bool
+	}{
+		{args: "", want: time.Time{}},
+		{args: "  ", want: time.Time{}},
+		{args: "2h", want: now.Add(2 * time.Hour)},
+		{args: "for 90m", want: now.Add(90 * time.Minute)},
+		{args: "1h30m", want: now.Add(90 * time.Minute)},
+		{args: "until 18:00", want: at(16, 18, 0)},
+		{args: "Until 14:31", want: at(16, 14, 31)},
+		{args: "23:15", want: at(16, 23, 15)},
+		{args: "until 14:30", want: at(17, 14, 30)},
+		{args: "until 07:00", want: at(17, 7, 0)},
+		{args: "until 24:00", want: at(17, 0, 0)},
+		{args: "0s", err: true},
+		{args: "for 0m", err: true},
+		{args: "-5m", err: true},
+		{args: "soon", err: true},
+		{args: "until 25:00", err: true},
+		{args: "until 7:xx", err: true},
+		{args: "10", err: true},
+	} {
+		got, err := parseOverrideUntil(tc.args, now, berlin)
+		if tc.err {
+			if err == nil {
+				t.Errorf("%q: expected an error, got %s", tc.args, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tc.args, err)
+			continue
+		}
+		if !got.Equal(tc.want) {
+			t.Errorf("%q = %s, want %s", tc.args, got, tc.want)
+		}
+	}
+}
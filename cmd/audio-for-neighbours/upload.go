@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+const (
+	defaultFFmpeg = "ffmpeg"
+	maxUploadSize = 20 << 20
+	maxNameLength = 100
+)
+
+var formatExts = map[audioFormat]string{
+	formatMP3:    ".mp3",
+	formatWAV:    ".wav",
+	formatFLAC:   ".flac",
+	formatVorbis: ".ogg",
+}
+
+// libraryMu serializes changes to the library folder, so uploads that run
+// at the same time cannot pick the same name.
+var libraryMu sync.Mutex
+
+// uploadExts are the extensions of uploaded documents that are worth trying
+// to decode or convert.
+var uploadExts = []string{".mp3", ".wav", ".flac", ".ogg", ".oga", ".opus", ".m4a", ".aac", ".wma"}
+
+// sanitizeFileName keeps letters, digits and a few punctuation marks of the
+// base name and replaces everything else, so an upload cannot escape the
+// folder or become a hidden file.
+func sanitizeFileName(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, `\`, "/"))
+	var b strings.Builder
+	for _, r := range name {
+		switch {
+		case unicode.IsLetter(r), unicode.IsDigit(r), strings.ContainsRune(" .-_()", r):
+			b.WriteRune(r)
+		default:
+			b.WriteRune('_')
+		}
+	}
+	clean := strings.Trim(b.String(), " ._")
+	if runes := []rune(clean); len(runes) > maxNameLength {
+		clean = strings.TrimSpace(string(runes[:maxNameLength]))
+	}
+	if clean == "" {
+		clean = "upload"
+	}
+	return clean
+}
+
+// addToLibrary checks that data decodes, converts it with ffmpeg when it
+// does not (e.g. Ogg Opus voice messages), and saves it into dir. It
+// returns the final file name and the duration.
+func addToLibrary(dir, name string, data []byte, ffmpeg string) (string, time.Duration, error) {
+	tmp, err := os.CreateTemp(dir, ".upload-*")
+	if err != nil {
+		return "", 0, err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", 0, err
+	}
+
+	path := tmp.Name()
+	format, length, err := checkAudio(path)
+	if err != nil {
+		converted := path + ".flac"
+		defer os.Remove(converted)
+		if convErr := convertAudio(ffmpeg, path, converted); convErr != nil {
+			return "", 0, fmt.Errorf("not a supported audio file, and conversion failed: %w", convErr)
+		}
+		path = converted
+		if format, length, err = checkAudio(path); err != nil {
+			return "", 0, fmt.Errorf("converted file: %w", err)
+		}
+	}
+
+	base := sanitizeFileName(name)
+	if ext := filepath.Ext(base); containsString(uploadExts, strings.ToLower(ext)) {
+		base = strings.TrimSuffix(base, ext)
+	}
+	libraryMu.Lock()
+	defer libraryMu.Unlock()
+	final, err := uniqueName(dir, base, formatExts[format])
+	if err != nil {
+		return "", 0, err
+	}
+	if err := os.Rename(path, filepath.Join(dir, final)); err != nil {
+		return "", 0, err
+	}
+	return final, length, nil
+}
+
+func checkAudio(path string) (audioFormat, time.Duration, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return formatUnknown, 0, err
+	}
+	defer f.Close()
+	header, err := readHeader(f)
+	if err != nil {
+		return formatUnknown, 0, err
+	}
+	format := sniffAudio(header, path)
+	streamer, info, err := decodeAudio(f, path)
+	if err != nil {
+		return format, 0, err
+	}
+	defer streamer.Close()
+	if n, _ := streamer.Stream(make([][2]float64, 512)); n == 0 {
+		return format, 0, errors.New("no audio in file")
+	}
+	return format, info.SampleRate.D(streamer.Len()), nil
+}
+
+func convertAudio(ffmpeg, in, out string) error {
+	if ffmpeg == "" {
+		ffmpeg = defaultFFmpeg
+	}
+	if _, err := exec.LookPath(ffmpeg); err != nil {
+		return fmt.Errorf("%s is not installed", ffmpeg)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, ffmpeg, "-hide_banner", "-loglevel", "error", "-y",
+		"-i", in, "-vn", "-c:a", "flac", "-sample_fmt", "s16", "-f", "flac", out)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+func uniqueName(dir, base, ext string) (string, error) {
+	for i := 1; i < 1000; i++ {
+		name := base + ext
+		if i > 1 {
+			name = fmt.Sprintf("%s (%d)%s", base, i, ext)
+		}
+		if _, err := os.Lstat(filepath.Join(dir, name)); errors.Is(err, os.ErrNotExist) {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("too many files named %s%s", base, ext)
+}
+
+// libraryFiles lists the real files of the library in play order, without
+// generators.
+func libraryFiles(dir string) ([]string, error) {
+	files, err := scanAudioFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	return applyLibraryOrder(files, readLibraryOrder(dir)), nil
+}
+
+// resolveLibraryFile finds a file by its number in libraryFiles or by its
+// exact name.
+func resolveLibraryFile(dir, ref string) (string, error) {
+	files, err := libraryFiles(dir)
+	if err != nil {
+		return "", err
+	}
+	if n, err := strconv.Atoi(ref); err == nil {
+		if n < 1 || n > len(files) {
+			return "", fmt.Errorf("no file number %d", n)
+		}
+		return filepath.Base(files[n-1]), nil
+	}
+	for _, file := range files {
+		if filepath.Base(file) == ref {
+			return ref, nil
+		}
+	}
+	return "", fmt.Errorf("no file named %q", ref)
+}
+
+// renameLibraryFile renames a file in dir and keeps its place in the saved
+// order. The extension is kept.
+func renameLibraryFile(dir, name, newName string) (string, error) {
+	libraryMu.Lock()
+	defer libraryMu.Unlock()
+	ext := filepath.Ext(name)
+	base := sanitizeFileName(newName)
+	if strings.EqualFold(filepath.Ext(base), ext) {
+		base = strings.TrimSuffix(base, filepath.Ext(base))
+	}
+	target, err := uniqueName(dir, base, ext)
+	if err != nil {
+		return "", err
+	}
+	if err := os.Rename(filepath.Join(dir, name), filepath.Join(dir, target)); err != nil {
+		return "", err
+	}
+	if order := readLibraryOrder(dir); len(order) > 0 {
+		for i, entry := range order {
+			if entry == name {
+				order[i] = target
+			}
+		}
+		if err := writeLibraryOrder(dir, order); err != nil {
+			return target, err
+		}
+	}
+	return target, nil
+}
+
+func deleteLibraryFile(dir, name string) error {
+	libraryMu.Lock()
+	defer libraryMu.Unlock()
+	if err := os.Remove(filepath.Join(dir, name)); err != nil {
+		return err
+	}
+	if order := readLibraryOrder(dir); len(order) > 0 {
+		kept := order[:0]
+		for _, entry := range order {
+			if entry != name {
+				kept = append(kept, entry)
+			}
+		}
+		return writeLibraryOrder(dir, kept)
+	}
+	return nil
+}
+
+func formatLibrary(files []string) string {
+	if len(files) == 0 {
+		return "Library is empty."
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "Library (%d files):", len(files))
+	for i, file := range files {
+		line := fmt.Sprintf("\n%d. %s", i+1, filepath.Base(file))
+		// Stay well below Telegram's 4096 character limit.
+		if b.Len()+len(line) > 3800 {
+			fmt.Fprintf(&b, "\n... and %d more", len(files)-i)
+			break
+		}
+		b.WriteString(line)
+	}
+	return b.String()
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchLibrary reports files that become playable in dir or disappear from
+// it. Events are collected until the folder has been quiet for a moment and
+// every file in it has settled, so a file being copied is reported once,
+// after the copy is done.
+func watchLibrary(ctx context.Context, dir string, onChange func(added, removed []string)) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Printf("library watch error: %v", err)
+		return
+	}
+	defer watcher.Close()
+	if err := watcher.Add(dir); err != nil {
+		log.Printf("library watch error: %s: %v", dir, err)
+		return
+	}
+
+	known, _ := scanAudioFiles(dir)
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("library watch error: %v", err)
+		case evt, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if strings.HasPrefix(filepath.Base(evt.Name), ".") || evt.Op == fsnotify.Chmod {
+				continue
+			}
+			timer.Reset(time.Second)
+		case <-timer.C:
+			files, err := scanAudioFiles(dir)
+			if err != nil {
+				log.Printf("library watch error: %v", err)
+				continue
+			}
+			added, removed := diffFiles(known, files)
+			known = files
+			if len(added) > 0 || len(removed) > 0 {
+				onChange(added, removed)
+			}
+			// Files still being written are skipped by the scan; look again
+			// once they have had time to settle.
+			if unsettled(dir) {
+				timer.Reset(fileSettleTime)
+			}
+		}
+	}
+}
+
+func diffFiles(before, after []string) (added, removed []string) {
+	for _, file := range after {
+		if !slices.Contains(before, file) {
+			added = append(added, filepath.Base(file))
+		}
+	}
+	for _, file := range before {
+		if !slices.Contains(after, file) {
+			removed = append(removed, filepath.Base(file))
+		}
+	}
+	return added, removed
+}
+
+func unsettled(dir string) bool {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return false
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		if info, err := entry.Info(); err == nil && time.Since(info.ModTime()) < fileSettleTime {
+			return true
+		}
+	}
+	return false
+}
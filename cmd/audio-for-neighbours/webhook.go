@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type webhookNotifier struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+type webhookPayload struct {
+	Event       string    `json:"event"`
+	Time        time.Time `json:"time"`
+	Text        string    `json:"text,omitempty"`
+	Filename    string    `json:"filename,omitempty"`
+	ContentType string    `json:"content_type,omitempty"`
+	Data        []byte    `json:"data,omitempty"`
+}
+
+func newWebhookNotifier(cfg NotifierConfig) (*webhookNotifier, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("webhook notifier needs url")
+	}
+	return &webhookNotifier{
+		url:     cfg.URL,
+		headers: cfg.Headers,
+		client:  &http.Client{Timeout: notifierTimeout},
+	}, nil
+}
+
+func (w *webhookNotifier) Name() string {
+	return "webhook"
+}
+
+func (w *webhookNotifier) SendText(kind, text string) error {
+	return w.post(webhookPayload{Event: kind, Time: time.Now(), Text: text})
+}
+
+func (w *webhookNotifier) SendPhoto(kind, filename string, data []byte) error {
+	return w.post(webhookPayload{Event: kind, Time: time.Now(), Filename: filename, ContentType: "image/jpeg", Data: data})
+}
+
+func (w *webhookNotifier) SendVideo(kind, filename string, data []byte) error {
+	return w.post(webhookPayload{Event: kind, Time: time.Now(), Filename: filename, ContentType: "video/mp4", Data: data})
+}
+
+func (w *webhookNotifier) post(payload webhookPayload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range w.headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 2048))
+		return fmt.Errorf("webhook status %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}